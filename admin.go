@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// defaultReenrichLimit is the max number of news re-queued by admin request without the limit parameter
+const defaultReenrichLimit = 100
+
+// adminAuth allows requests with the admin bearer token only
+func (api *APIServer) adminAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(api.cfg.AdminToken)) != 1 {
+			writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// adminNewsHandler returns page of news with enrichment details, including the last error,
+// filtered the same way as the listing, e.g. to find items failed to enrich
+// GET /api/v1/admin/news?enrichment=failed&attempts=3&cursor=...&pagesize=20
+func (api *APIServer) adminNewsHandler(ctx context.Context) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filters, err := parseFilters(r)
+		if err != nil {
+			writeValidationError(w, err)
+			return
+		}
+
+		news, meta, err := api.listNews(ctx, filters)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "failed to get news")
+			return
+		}
+
+		type adminNewsItem struct {
+			NewsItem
+			LastError string `json:"last_error,omitempty"`
+		}
+		items := make([]adminNewsItem, 0, len(news))
+		for _, item := range news {
+			items = append(items, adminNewsItem{NewsItem: item, LastError: item.LastError})
+		}
+
+		writeJSON(w, http.StatusOK, struct {
+			News     []adminNewsItem `json:"news"`
+			Metadata Metadata        `json:"metadata"`
+		}{
+			News:     items,
+			Metadata: meta,
+		})
+	}
+}
+
+// reenrichHandler re-queues single news item or news published within the date range for enrichment,
+// up to the limit, most incomplete first. Returns the number of queued items
+// POST /api/v1/admin/reenrich?id=1 or ?from=2024-07-01&to=2024-07-31&limit=500
+func (api *APIServer) reenrichHandler(ctx context.Context) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		filter := ReenrichFilter{Limit: defaultReenrichLimit}
+
+		var err error
+		if limitStr := query.Get("limit"); limitStr != "" {
+			filter.Limit, err = strconv.Atoi(limitStr)
+			if err != nil || filter.Limit < 1 {
+				writeJSONError(w, http.StatusBadRequest, "invalid limit")
+				return
+			}
+		}
+		if idStr := query.Get("id"); idStr != "" {
+			filter.ID, err = strconv.Atoi(idStr)
+			if err != nil || filter.ID < 1 {
+				writeJSONError(w, http.StatusBadRequest, "invalid id")
+				return
+			}
+		}
+		filter.From, err = parseDate(query.Get("from"), false)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		filter.To, err = parseDate(query.Get("to"), true)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if filter.ID == 0 && filter.From.IsZero() && filter.To.IsZero() {
+			writeJSONError(w, http.StatusBadRequest, "id or date range is required")
+			return
+		}
+
+		queued, err := api.Storage.RequeueNews(ctx, filter)
+		if err != nil {
+			log.Printf("[ERROR] failed to re-queue news: %v", err)
+			writeJSONError(w, http.StatusInternalServerError, "failed to re-queue news")
+			return
+		}
+		if filter.ID != 0 && queued == 0 {
+			writeJSONError(w, http.StatusNotFound, "news not found")
+			return
+		}
+		log.Printf("[INFO] %d news re-queued for enrichment by admin request", queued)
+
+		writeJSON(w, http.StatusAccepted, map[string]int{"queued": queued})
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ReenrichHandler(t *testing.T) {
+	storage := &stubStorer{news: syndicationNews}
+	api, err := NewAPIServer(storage, APIConfig{AdminToken: "secret"})
+	assert.NoError(t, err)
+
+	ts := httptest.NewServer(api.router(context.Background()))
+	defer ts.Close()
+
+	cases := []struct {
+		name   string
+		query  string
+		token  string
+		status int
+		filter ReenrichFilter
+	}{
+		{name: "no token", query: "?id=1", status: http.StatusUnauthorized},
+		{name: "wrong token", query: "?id=1", token: "wrong", status: http.StatusUnauthorized},
+		{name: "no params", token: "secret", status: http.StatusBadRequest},
+		{name: "invalid id", query: "?id=abc", token: "secret", status: http.StatusBadRequest},
+		{name: "invalid date", query: "?from=yesterday", token: "secret", status: http.StatusBadRequest},
+		{name: "invalid limit", query: "?from=2024-07-01&limit=0", token: "secret", status: http.StatusBadRequest},
+		{name: "unknown id", query: "?id=10", token: "secret", status: http.StatusNotFound, filter: ReenrichFilter{ID: 10, Limit: defaultReenrichLimit}},
+		{name: "single item", query: "?id=1", token: "secret", status: http.StatusAccepted, filter: ReenrichFilter{ID: 1, Limit: defaultReenrichLimit}},
+		{
+			name:   "date range",
+			query:  "?from=2024-07-01&to=2024-07-31",
+			token:  "secret",
+			status: http.StatusAccepted,
+			filter: ReenrichFilter{
+				From:  time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC),
+				To:    time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC),
+				Limit: defaultReenrichLimit,
+			},
+		},
+		{
+			name:   "date range with limit",
+			query:  "?from=2024-07-01&limit=500",
+			token:  "secret",
+			status: http.StatusAccepted,
+			filter: ReenrichFilter{From: time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC), Limit: 500},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			storage.reenrich = ReenrichFilter{}
+			req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/admin/reenrich"+tc.query, http.NoBody)
+			assert.NoError(t, err)
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			assert.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, tc.status, resp.StatusCode)
+			assert.Equal(t, tc.filter, storage.reenrich)
+		})
+	}
+
+	// admin API is not routed without the token
+	api, err = NewAPIServer(storage, APIConfig{})
+	assert.NoError(t, err)
+	rec := httptest.NewRecorder()
+	api.router(context.Background()).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/admin/reenrich?id=1", http.NoBody))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func Test_AdminNewsHandler(t *testing.T) {
+	storage := &stubStorer{news: []NewsItem{
+		{ID: 1, Title: "Failed", EnrichmentStatus: EnrichmentFailed, EnrichmentAttempts: 3, LastError: "page not found"},
+	}}
+	api, err := NewAPIServer(storage, APIConfig{AdminToken: "secret"})
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/news?enrichment=failed&attempts=3", http.NoBody)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	api.router(context.Background()).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, EnrichmentFailed, storage.filters.EnrichmentStatus)
+	assert.Equal(t, 3, storage.filters.MinAttempts)
+
+	body := struct {
+		News []map[string]any `json:"news"`
+	}{}
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	assert.Len(t, body.News, 1)
+	assert.Equal(t, "failed", body.News[0]["enrichment_status"])
+	assert.Equal(t, "page not found", body.News[0]["last_error"])
+
+	// the last error is not exposed by the public API
+	rec = httptest.NewRecorder()
+	api.router(context.Background()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/news", http.NoBody))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "page not found")
+}
@@ -1,18 +1,24 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha1" //nolint:gosec // used for ETag only
 	"embed"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-pkgz/rest"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 //go:embed all:web
@@ -22,12 +28,15 @@ var web embed.FS
 type Storer interface {
 	GetNews(ctx context.Context, filters Filters) ([]NewsItem, Metadata, error)
 	GetSingleNews(ctx context.Context, id int) (*NewsItem, error)
+	RequeueNews(ctx context.Context, f ReenrichFilter) (int, error)
+	GetRevisions(ctx context.Context, newsID int) ([]NewsRevision, error)
 }
 
 // APIServer ..
 type APIServer struct {
 	Storage Storer
 	cfg     APIConfig
+	checks  []namedCheck // readiness checks of dependencies
 }
 
 // NewServer creates new API server
@@ -94,36 +103,330 @@ func (api *APIServer) getSingleNews(ctx context.Context, id int) (*NewsItem, err
 // router creates http router
 func (api *APIServer) router(ctx context.Context) http.Handler {
 	router := chi.NewRouter()
+	router.Use(metricsMiddleware)
 	router.Use(rest.Throttle(5))
 
 	// Web UI
 	router.Get("/", api.indexHandler(ctx))
 	router.Get("/article", api.articleHandler(ctx))
+	router.Get("/article/history", api.historyHandler(ctx))
+
+	// JSON API
+	router.Route("/api/v1", func(r chi.Router) {
+		r.Get("/news", api.listNewsHandler(ctx))
+		r.Get("/news/{id}", api.singleNewsHandler(ctx))
+
+		// admin API is available with the token only
+		if api.cfg.AdminToken != "" {
+			r.With(api.adminAuth).Get("/admin/news", api.adminNewsHandler(ctx))
+			r.With(api.adminAuth).Post("/admin/reenrich", api.reenrichHandler(ctx))
+		}
+	})
+
+	// Probes
+	router.Get("/healthz", api.healthzHandler())
+	router.Get("/readyz", api.readyzHandler())
+
+	// Prometheus metrics
+	router.Handle("/metrics", promhttp.Handler())
+
+	// Outgoing feeds
+	router.Get("/feed.rss", api.syndicationHandler(ctx, rssFormat))
+	router.Get("/feed.atom", api.syndicationHandler(ctx, atomFormat))
+	router.Get("/feed.json", api.syndicationHandler(ctx, jsonFeedFormat))
 
 	return router
 }
 
+// ValidationError maps invalid query parameters to the reasons
+type ValidationError map[string]string
+
+// Error lists invalid parameters in alphabetical order
+func (e ValidationError) Error() string {
+	params := make([]string, 0, len(e))
+	for param := range e {
+		params = append(params, param)
+	}
+	sort.Strings(params)
+
+	reasons := make([]string, 0, len(params))
+	for _, param := range params {
+		reasons = append(reasons, param+": "+e[param])
+	}
+	return "invalid parameters: " + strings.Join(reasons, ", ")
+}
+
+// parseFilters reads paging and filtering parameters from query string. Invalid parameters are
+// left zero and reported with ValidationError, API returns it to the client, web UI ignores it
+func parseFilters(r *http.Request) (Filters, error) {
+	query := r.URL.Query()
+	filters := Filters{}
+	errs := ValidationError{}
+
+	// count parses non-negative integer parameter, zero if it is not set
+	count := func(param string) int {
+		s := query.Get(param)
+		if s == "" {
+			return 0
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			errs[param] = "must be a non-negative integer"
+			return 0
+		}
+		return n
+	}
+
+	// flag parses boolean parameter, nil if it is not set
+	flag := func(param string) *bool {
+		s := query.Get(param)
+		if s == "" {
+			return nil
+		}
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			errs[param] = "must be true or false"
+			return nil
+		}
+		return &b
+	}
+
+	var err error
+	filters.PageSize = count("pagesize")
+	filters.FeedID = count("feed")
+	filters.Query = strings.TrimSpace(query.Get("q"))
+
+	if filters.From, err = parseDate(query.Get("from"), false); err != nil {
+		errs["from"] = err.Error()
+	}
+	if filters.To, err = parseDate(query.Get("to"), true); err != nil {
+		errs["to"] = err.Error()
+	}
+	if !filters.From.IsZero() && !filters.To.IsZero() && !filters.From.Before(filters.To) {
+		errs["to"] = "must be after from"
+	}
+
+	filters.HasImage = flag("has_image")
+	filters.HasDescription = flag("has_description")
+
+	switch filters.Sort = query.Get("sort"); filters.Sort {
+	case "", SortPublishedDesc, SortPublishedAsc:
+	case SortRelevance:
+		if filters.Query == "" {
+			errs["sort"] = "relevance requires search query"
+		}
+	default:
+		errs["sort"] = fmt.Sprintf("must be one of %s, %s, %s", SortPublishedDesc, SortPublishedAsc, SortRelevance)
+		filters.Sort = ""
+	}
+
+	if collapse := flag("collapse"); collapse != nil {
+		filters.Collapse = *collapse
+	}
+	filters.ClusterID = count("cluster")
+
+	switch filters.EnrichmentStatus = query.Get("enrichment"); filters.EnrichmentStatus {
+	case "", EnrichmentPending, EnrichmentSuccess, EnrichmentFailed:
+	default:
+		errs["enrichment"] = fmt.Sprintf("must be one of %s, %s, %s", EnrichmentPending, EnrichmentSuccess, EnrichmentFailed)
+		filters.EnrichmentStatus = ""
+	}
+	filters.MinAttempts = count("attempts")
+
+	// offset pagination is replaced with cursors, old clients get an explicit error instead of the first page
+	if query.Has("page") {
+		errs["page"] = "is not supported, pass cursor from metadata"
+	}
+
+	// cursor is valid for the order it was issued for
+	if filters.Cursor, err = DecodeCursor(query.Get("cursor")); err != nil {
+		errs["cursor"] = err.Error()
+	} else if !filters.Cursor.IsZero() && filters.Cursor.Sort != filters.sortOrder() {
+		errs["cursor"] = "issued for another sort order"
+		filters.Cursor = Cursor{}
+	}
+
+	if len(errs) > 0 {
+		return filters, errs
+	}
+	return filters, nil
+}
+
+// parseDate parses RFC3339 timestamp or date. Date is taken as the start of the day,
+// or the start of the next day if endOfDay is set, to include the whole day in a range
+func parseDate(s string, endOfDay bool) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD or RFC3339", s)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+
+	return t, nil
+}
+
+// JSON API handlers
+
+// writeJSON writes data as JSON response with given status code
+func writeJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(data)
+	if err != nil {
+		log.Printf("failed to encode JSON response: %v", err)
+	}
+}
+
+// writeJSONError writes error message as JSON response with given status code
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// writeValidationError writes 400 response with the reason of every invalid parameter
+func writeValidationError(w http.ResponseWriter, err error) {
+	var verr ValidationError
+	if !errors.As(err, &verr) {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusBadRequest, struct {
+		Error  string            `json:"error"`
+		Fields map[string]string `json:"fields"`
+	}{
+		Error:  "invalid parameters",
+		Fields: verr,
+	})
+}
+
+// listNewsHandler returns page of news with pagination metadata
+// GET /api/v1/news?cursor=...&pagesize=5&feed=1&q=search+terms&from=2024-07-01&to=2024-07-31&has_image=true&has_description=true&sort=relevance&enrichment=failed&attempts=3
+func (api *APIServer) listNewsHandler(ctx context.Context) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filters, err := parseFilters(r)
+		if err != nil {
+			writeValidationError(w, err)
+			return
+		}
+
+		news, meta, err := api.listNews(ctx, filters)
+		if err != nil {
+			log.Printf("failed to get listNews: %v", err)
+			writeJSONError(w, http.StatusInternalServerError, "failed to get news")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, struct {
+			News     []NewsItem `json:"news"`
+			Metadata Metadata   `json:"metadata"`
+		}{
+			News:     news,
+			Metadata: meta,
+		})
+	}
+}
+
+// singleNewsHandler returns single news item by id
+// GET /api/v1/news/{id}
+func (api *APIServer) singleNewsHandler(ctx context.Context) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			log.Printf("failed to parse id: %v", err)
+			writeJSONError(w, http.StatusBadRequest, "invalid id")
+			return
+		}
+
+		item, err := api.getSingleNews(ctx, id)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				writeJSONError(w, http.StatusNotFound, "news not found")
+				return
+			}
+			writeJSONError(w, http.StatusInternalServerError, "failed to get news")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, item)
+	}
+}
+
+// Outgoing feed handlers
+
+// syndicationHandler renders latest news as a feed of given format, filtered the same way as
+// the listing. ETag and Last-Modified are set, so conditional requests are answered with 304
+// GET /feed.rss?feed=1&q=search+terms&from=2024-07-01&to=2024-07-31
+func (api *APIServer) syndicationHandler(ctx context.Context, format feedFormat) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// invalid parameters are ignored, feed readers can't show errors
+		filters, _ := parseFilters(r)
+		filters.validate(feedDefaultFilters)
+
+		news, _, err := api.listNews(ctx, filters)
+		if err != nil {
+			log.Printf("failed to get listNews: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		info := feedInfo{
+			Title:   "Latest News",
+			Link:    requestBaseURL(r) + "/",
+			SelfURL: requestBaseURL(r) + r.URL.RequestURI(),
+			Updated: lastUpdated(news),
+		}
+		body, err := format.render(info, news)
+		if err != nil {
+			log.Printf("failed to render feed: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		sum := sha1.Sum(body)
+		w.Header().Set("Content-Type", format.contentType)
+		w.Header().Set("ETag", fmt.Sprintf(`"%x"`, sum[:10]))
+		http.ServeContent(w, r, "", info.Updated, bytes.NewReader(body))
+	}
+}
+
 // Web UI handlers
 
 // funcMap is a map of functions to be used in templates
 var funcMap = template.FuncMap{
-	"sub":      func(a, b int) int { return a - b },
-	"add":      func(a, b int) int { return a + b },
-	"dateStr":  func(t time.Time) string { return t.Format("January 2, 2006 15:04") },
-	"unescape": func(s string) template.HTML { return template.HTML(s) },
+	"sub":       func(a, b int) int { return a - b },
+	"add":       func(a, b int) int { return a + b },
+	"dateStr":   func(t time.Time) string { return t.Format("January 2, 2006 15:04") },
+	"highlight": highlight,
+	"join":      strings.Join,
+	"rfc3339":   func(t time.Time) string { return t.Format(time.RFC3339) },
+	"paragraphs": func(s string) []string {
+		if s == "" {
+			return nil
+		}
+		return strings.Split(s, "\n\n")
+	},
+}
+
+// highlight escapes search snippet text and keeps the <mark> tags of the matches only
+func highlight(snippet string) template.HTML {
+	escaped := template.HTMLEscapeString(snippet)
+	return template.HTML(strings.NewReplacer("&lt;mark&gt;", "<mark>", "&lt;/mark&gt;", "</mark>").Replace(escaped)) //nolint:gosec // escaped above
 }
 
 // indexHandler renders index page
 func (api *APIServer) indexHandler(ctx context.Context) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 
-		// parse paging parameters
-		filters := Filters{}
-		pageStr := r.URL.Query().Get("page")
-		filters.Page, _ = strconv.Atoi(pageStr)
-
-		pageSizeStr := r.URL.Query().Get("pagesize")
-		filters.PageSize, _ = strconv.Atoi(pageSizeStr)
+		// parse paging parameters, invalid ones are ignored
+		filters, _ := parseFilters(r)
 
 		// validate by fallback to default, don`t yell on user, show something
 		filters.validate(defaultFilters)
@@ -138,9 +441,11 @@ func (api *APIServer) indexHandler(ctx context.Context) func(http.ResponseWriter
 		envelope := struct {
 			News     []NewsItem
 			Metadata Metadata
+			Filters  Filters
 		}{
 			News:     news,
 			Metadata: meta,
+			Filters:  filters,
 		}
 
 		tpl := template.Must(template.New("index.html").Funcs(funcMap).ParseFS(web, "web/index.html"))
@@ -183,3 +488,48 @@ func (api *APIServer) articleHandler(ctx context.Context) func(http.ResponseWrit
 		}
 	}
 }
+
+// historyHandler renders changes of the article title and publication time, as a word diff
+func (api *APIServer) historyHandler(ctx context.Context) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idStr := r.URL.Query().Get("id")
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			log.Printf("failed to parse id: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		item, err := api.getSingleNews(ctx, id)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		revisions, err := api.Storage.GetRevisions(ctx, id)
+		if err != nil {
+			log.Printf("failed to get revisions: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		envelope := struct {
+			Item    *NewsItem
+			History []historyEntry
+		}{
+			Item:    item,
+			History: buildHistory(item, revisions),
+		}
+
+		tpl := template.Must(template.New("history.html").Funcs(funcMap).ParseFS(web, "web/history.html"))
+		err = tpl.Execute(w, envelope)
+		if err != nil {
+			log.Printf("failed to render template: %v", err)
+			return
+		}
+	}
+}
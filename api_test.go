@@ -3,6 +3,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"html/template"
 	"log"
@@ -10,6 +11,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/testcontainers/testcontainers-go/modules/rabbitmq"
@@ -40,8 +42,13 @@ func SetupRmqContainer(ctx context.Context, t *testing.T) (*RMQConfig, error) {
 	}
 
 	var cfg = RMQConfig{
-		Dsn:  amqpURL,
-		Name: "test",
+		Dsn:            amqpURL,
+		Name:           "test",
+		MaxRetries:     2,
+		RetryDelay:     "100ms",
+		Prefetch:       10,
+		PublishBuffer:  100,
+		PublishTimeout: "5s",
 	}
 
 	return &cfg, nil
@@ -49,7 +56,8 @@ func SetupRmqContainer(ctx context.Context, t *testing.T) (*RMQConfig, error) {
 
 func Setup(ctx context.Context, t *testing.T) (*Config, error) {
 	cfg := Config{
-		RssUrl: "https://feeds.bbci.co.uk/news/world/rss.xml",
+		RssUrls: []string{"https://feeds.bbci.co.uk/news/world/rss.xml"},
+		RssTtl:  "15m",
 	}
 
 	// Setup Postgres container
@@ -96,7 +104,11 @@ func Test_LoadEnrichList(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Initial news load
-	items, err := s.Parser.GetNews(ctx)
+	feeds, err := s.Storage.GetFeeds(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, feeds, 1)
+
+	items, _, err := s.Parser.GetNews(ctx, feeds[0])
 	assert.NoError(t, err)
 
 	saved := 0
@@ -109,7 +121,7 @@ func Test_LoadEnrichList(t *testing.T) {
 		assert.NoError(t, err)
 
 		if err == nil {
-			err := s.EnrichNewsItem(ctx, item.Link)
+			err := s.EnrichNewsItem(ctx, NewEnrichMessage(&item))
 			assert.NoError(t, err)
 		}
 	}
@@ -124,22 +136,25 @@ func Test_LoadEnrichList(t *testing.T) {
 
 	// Test listNews with default filters
 	list, meta, err := api.listNews(context.Background(),
-		Filters{defaultFilters.Page, defaultFilters.PageSize})
+		Filters{PageSize: defaultFilters.PageSize})
 	assert.NoError(t, err)
 	assert.NotNil(t, list)
 	assert.NotNil(t, meta)
 
-	assert.Equal(t, saved, meta.TotalRecords)
+	assert.NotEmpty(t, meta.Next)
+	assert.Empty(t, meta.Prev)
 	assert.Equal(t, defaultFilters.PageSize, len(list)) // correct page size
 
 	// Test loading second page
+	cursor, err := DecodeCursor(meta.Next)
+	assert.NoError(t, err)
 	list2, meta, err := api.listNews(context.Background(),
-		Filters{defaultFilters.Page + 1, defaultFilters.PageSize})
+		Filters{PageSize: defaultFilters.PageSize, Cursor: cursor})
 	assert.NoError(t, err)
 	assert.NotNil(t, list2)
 	assert.NotNil(t, meta)
 
-	assert.Equal(t, saved, meta.TotalRecords)
+	assert.NotEmpty(t, meta.Prev)
 	assert.Equal(t, defaultFilters.PageSize, len(list)) // correct page size
 
 	assert.NotEqual(t, list[0].ID, list2[0].ID)       // different items
@@ -147,12 +162,13 @@ func Test_LoadEnrichList(t *testing.T) {
 
 	// Test listNews, filter all news
 	listAll, meta, err := api.listNews(context.Background(),
-		Filters{defaultFilters.Page, meta.TotalRecords + 10})
+		Filters{PageSize: saved + 10})
 	assert.NoError(t, err)
 	assert.NotNil(t, listAll)
 	assert.NotNil(t, meta)
 
-	assert.Equal(t, meta.TotalRecords, len(listAll))
+	assert.Equal(t, saved, len(listAll))
+	assert.Empty(t, meta.Next)
 
 	// Test get single news
 	singleNews, err := api.getSingleNews(context.Background(), listAll[0].ID)
@@ -166,11 +182,12 @@ func Test_LoadEnrichList(t *testing.T) {
 	assert.Equal(t, listAll[0].Description, singleNews.Description)
 
 	// Test listNews, filter over limit
+	last := listAll[len(listAll)-1]
 	listEmpty, meta, err := api.listNews(context.Background(),
-		Filters{defaultFilters.Page + 1, meta.TotalRecords + 10})
+		Filters{PageSize: saved + 10, Cursor: Cursor{Published: last.Published, ID: last.ID}})
 	assert.NoError(t, err)
 	assert.Equal(t, []NewsItem{}, listEmpty)
-	assert.Equal(t, Metadata{}, meta)
+	assert.Equal(t, Metadata{PageSize: saved + 10}, meta)
 
 	// Test get single news with invalid ID
 	singleNews, err = api.getSingleNews(context.Background(), 0)
@@ -194,13 +211,13 @@ func Test_LoadEnrichList(t *testing.T) {
 
 	// News items should be present on the page
 	for _, item := range list {
-		assert.True(t, strings.Contains(body, string(template.HTML(item.Title))), "Title should be present")             // unescaped
-		assert.True(t, strings.Contains(body, string(template.HTML(item.Description))), "Description should be present") // unescaped
+		assert.True(t, strings.Contains(body, htmlText(item.Title)), "Title should be present")             // escaped
+		assert.True(t, strings.Contains(body, htmlText(item.Description)), "Description should be present") // escaped
 		assert.True(t, strings.Contains(body, item.Image), "Image URL should be present")
 	}
 
 	// Test second page
-	req = httptest.NewRequest("GET", "/?page=2", nil) // default page size is 5
+	req = httptest.NewRequest("GET", "/?cursor="+Cursor{Published: list[len(list)-1].Published, ID: list[len(list)-1].ID}.Encode(), nil) // default page size is 5
 	w = httptest.NewRecorder()
 	indexHandler(w, req)
 	resp = w.Result()
@@ -210,13 +227,13 @@ func Test_LoadEnrichList(t *testing.T) {
 
 	// News items should be present on the page
 	for _, item := range list2 {
-		assert.True(t, strings.Contains(body, string(template.HTML(item.Title))), "Title should be present")             // unescaped
-		assert.True(t, strings.Contains(body, string(template.HTML(item.Description))), "Description should be present") // unescaped
+		assert.True(t, strings.Contains(body, htmlText(item.Title)), "Title should be present")             // escaped
+		assert.True(t, strings.Contains(body, htmlText(item.Description)), "Description should be present") // escaped
 		assert.True(t, strings.Contains(body, item.Image), "Image URL should be present")
 	}
 
 	// Test All news
-	req = httptest.NewRequest("GET", "/?page=1&pagesize=100", nil)
+	req = httptest.NewRequest("GET", "/?pagesize=100", nil)
 	w = httptest.NewRecorder()
 	indexHandler(w, req)
 	resp = w.Result()
@@ -224,7 +241,7 @@ func Test_LoadEnrichList(t *testing.T) {
 	assert.Equal(t, saved, strings.Count(w.Body.String(), "<div class=\"news-item\">"))
 
 	// Test page over limit
-	req = httptest.NewRequest("GET", "/?page=2&pagesize=100", nil)
+	req = httptest.NewRequest("GET", "/?pagesize=100&cursor="+Cursor{Published: last.Published, ID: last.ID}.Encode(), nil)
 	w = httptest.NewRecorder()
 	indexHandler(w, req)
 	resp = w.Result()
@@ -261,4 +278,194 @@ func Test_LoadEnrichList(t *testing.T) {
 	assert.True(t, strings.Contains(body, string(template.HTML(listAll[0].Description))), "Description should be present")
 	assert.True(t, strings.Contains(body, listAll[0].Image), "Image URL should be present")
 
+	// Test JSON API through the router, {id} is resolved by chi
+	router := s.ApiServer.router(ctx)
+
+	// Test news list
+	req = httptest.NewRequest("GET", "/api/v1/news?pagesize=100", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	resp = w.Result()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json; charset=utf-8", resp.Header.Get("Content-Type"))
+
+	envelope := struct {
+		News     []NewsItem `json:"news"`
+		Metadata Metadata   `json:"metadata"`
+	}{}
+	err = json.NewDecoder(w.Body).Decode(&envelope)
+	assert.NoError(t, err)
+	assert.Equal(t, saved, len(envelope.News))
+	assert.Empty(t, envelope.Metadata.Next)
+	assert.Equal(t, listAll[0].ID, envelope.News[0].ID)
+
+	// Test single news
+	req = httptest.NewRequest("GET", fmt.Sprintf("/api/v1/news/%d", listAll[0].ID), nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	resp = w.Result()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	jsonItem := NewsItem{}
+	err = json.NewDecoder(w.Body).Decode(&jsonItem)
+	assert.NoError(t, err)
+	assert.Equal(t, listAll[0].ID, jsonItem.ID)
+	assert.Equal(t, listAll[0].Title, jsonItem.Title)
+	assert.Equal(t, listAll[0].Description, jsonItem.Description)
+
+	// Test single news with invalid numeric ID should return http.StatusNotFound
+	req = httptest.NewRequest("GET", "/api/v1/news/0", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Result().StatusCode, "Should return 404")
+	assert.JSONEq(t, `{"error":"news not found"}`, w.Body.String())
+
+	// Test single news with non-numeric ID should return http.StatusBadRequest
+	req = httptest.NewRequest("GET", "/api/v1/news/invalid", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode, "Should return 400")
+	assert.JSONEq(t, `{"error":"invalid id"}`, w.Body.String())
+}
+
+func Test_ParseFilters(t *testing.T) {
+	yes, no := true, false
+	cursor := Cursor{Sort: SortPublishedAsc, Published: time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC), ID: 3}
+
+	cases := []struct {
+		name   string
+		query  string
+		want   Filters
+		fields []string // invalid parameters
+	}{
+		{name: "empty", query: "", want: Filters{}},
+		{
+			name:  "all valid",
+			query: "pagesize=10&feed=2&q=+budget+&from=2024-07-01&to=2024-07-31&has_image=true&has_description=0&sort=relevance&collapse=true&cluster=7",
+			want: Filters{
+				PageSize: 10, FeedID: 2, Query: "budget",
+				From:     time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC),
+				To:       time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC),
+				HasImage: &yes, HasDescription: &no, Sort: SortRelevance,
+				Collapse: true, ClusterID: 7,
+			},
+		},
+		{name: "cursor of the same order", query: "sort=published_asc&cursor=" + cursor.Encode(), want: Filters{Sort: SortPublishedAsc, Cursor: cursor}},
+		{name: "invalid numbers", query: "pagesize=-1&feed=abc&attempts=x", fields: []string{"attempts", "feed", "pagesize"}},
+		{name: "invalid dates", query: "from=yesterday&to=2024-13-01", fields: []string{"from", "to"}},
+		{name: "reversed range", query: "from=2024-07-31&to=2024-07-01", fields: []string{"to"}},
+		{name: "invalid flags", query: "has_image=maybe&has_description=yes&collapse=1x", fields: []string{"collapse", "has_description", "has_image"}},
+		{name: "unknown sort", query: "sort=title", fields: []string{"sort"}},
+		{name: "relevance without query", query: "sort=relevance", fields: []string{"sort"}},
+		{name: "unknown enrichment status", query: "enrichment=done", fields: []string{"enrichment"}},
+		{name: "invalid cursor", query: "cursor=abc", fields: []string{"cursor"}},
+		{name: "page number", query: "page=2", fields: []string{"page"}},
+		{name: "cursor of another order", query: "cursor=" + cursor.Encode(), fields: []string{"cursor"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			filters, err := parseFilters(httptest.NewRequest(http.MethodGet, "/?"+tc.query, http.NoBody))
+			if tc.fields == nil {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.want, filters)
+				return
+			}
+
+			var verr ValidationError
+			assert.ErrorAs(t, err, &verr)
+			fields := make([]string, 0, len(verr))
+			for field := range verr {
+				fields = append(fields, field)
+			}
+			assert.ElementsMatch(t, tc.fields, fields)
+		})
+	}
+}
+
+func Test_ListNewsValidation(t *testing.T) {
+	storage := &stubStorer{}
+	api, err := NewAPIServer(storage, APIConfig{})
+	assert.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	api.router(context.Background()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/news?from=bad&sort=title", http.NoBody))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	body := struct {
+		Error  string            `json:"error"`
+		Fields map[string]string `json:"fields"`
+	}{}
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	assert.Equal(t, "invalid parameters", body.Error)
+	assert.Contains(t, body.Fields["from"], "invalid date")
+	assert.Contains(t, body.Fields["sort"], "must be one of")
+
+	// web UI ignores invalid parameters
+	rec = httptest.NewRecorder()
+	api.router(context.Background()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?from=bad&sort=title", http.NoBody))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func Test_ValidationError(t *testing.T) {
+	err := ValidationError{"to": "must be after from", "feed": "must be a non-negative integer"}
+	assert.Equal(t, "invalid parameters: feed: must be a non-negative integer, to: must be after from", err.Error())
+}
+
+// htmlText returns text as html/template renders it in HTML content
+func htmlText(text string) string {
+	buf := strings.Builder{}
+	_ = template.Must(template.New("").Parse("{{.}}")).Execute(&buf, text)
+	return buf.String()
+}
+
+func Test_DescriptionEscaped(t *testing.T) {
+	item := NewsItem{ID: 1, Title: "<i>Title</i>", Description: "<script>alert(1)</script> & more", Snippet: "<b>bold</b> <mark>match</mark>"}
+	api, err := NewAPIServer(&stubStorer{news: []NewsItem{item}}, APIConfig{})
+	assert.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	api.router(context.Background()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/article?id=1", http.NoBody))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "<script>")
+	assert.Contains(t, rec.Body.String(), "&lt;script&gt;alert(1)&lt;/script&gt; &amp; more")
+	assert.NotContains(t, rec.Body.String(), "<i>Title</i>")
+
+	// search snippet keeps the match highlights only
+	rec = httptest.NewRecorder()
+	api.router(context.Background()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "&lt;b&gt;bold&lt;/b&gt; <mark>match</mark>")
+	assert.Contains(t, rec.Body.String(), "<h5>&lt;i&gt;Title&lt;/i&gt;</h5>")
+}
+
+func Test_NewsTimesOmitted(t *testing.T) {
+	modified := time.Date(2024, 7, 2, 12, 30, 0, 0, time.UTC)
+	news := []NewsItem{
+		{ID: 1, Title: "Not enriched", Published: time.Date(2024, 7, 1, 10, 0, 0, 0, time.UTC)},
+		{ID: 2, Title: "Enriched", Published: time.Date(2024, 7, 1, 10, 0, 0, 0, time.UTC), ArticleModified: &modified, EnrichedAt: &modified},
+	}
+	api, err := NewAPIServer(&stubStorer{news: news}, APIConfig{})
+	assert.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	api.router(context.Background()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/news/1", http.NoBody))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "article_published")
+	assert.NotContains(t, rec.Body.String(), "article_modified")
+	assert.NotContains(t, rec.Body.String(), "enriched_at")
+
+	rec = httptest.NewRecorder()
+	api.router(context.Background()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/news/2", http.NoBody))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"article_modified":"2024-07-02T12:30:00Z"`)
+	assert.Contains(t, rec.Body.String(), `"enriched_at":"2024-07-02T12:30:00Z"`)
+
+	// the page shows the update time of the article only
+	rec = httptest.NewRecorder()
+	api.router(context.Background()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/article?id=1", http.NoBody))
+	assert.NotContains(t, rec.Body.String(), "Updated:")
+	rec = httptest.NewRecorder()
+	api.router(context.Background()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/article?id=2", http.NoBody))
+	assert.Contains(t, rec.Body.String(), "Updated: July 2, 2024 12:30")
 }
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+// Article is structured data extracted from the article page
+type Article struct {
+	Description  string
+	Image        string
+	Body         string // paragraphs separated by empty line
+	Authors      []string
+	Section      string
+	Tags         []string
+	CanonicalURL string
+	Publisher    string
+	Published    time.Time
+	Modified     time.Time
+	Meta         map[string]string // og:*, twitter:* and article:* properties, first value wins
+}
+
+// applyTo sets non-empty article fields to the news item, returns number of fields applied
+func (a *Article) applyTo(item *NewsItem) int {
+	applied := 0
+	setString := func(dst *string, v string) {
+		if v != "" {
+			*dst = v
+			applied++
+		}
+	}
+	setStrings := func(dst *[]string, v []string) {
+		if len(v) > 0 {
+			*dst = v
+			applied++
+		}
+	}
+	setTime := func(dst **time.Time, v time.Time) {
+		if !v.IsZero() {
+			*dst = &v
+			applied++
+		}
+	}
+
+	setString(&item.Description, a.Description)
+	setString(&item.Image, a.Image)
+	setString(&item.Body, a.Body)
+	setStrings(&item.Authors, a.Authors)
+	setString(&item.Section, a.Section)
+	setStrings(&item.Tags, a.Tags)
+	setString(&item.CanonicalURL, a.CanonicalURL)
+	setString(&item.Publisher, a.Publisher)
+	setTime(&item.ArticlePublished, a.Published)
+	setTime(&item.ArticleModified, a.Modified)
+	if len(a.Meta) > 0 {
+		item.Meta = a.Meta
+		applied++
+	}
+
+	return applied
+}
+
+// merge sets non-empty fields of other article over the article ones, meta properties are kept
+func (a *Article) merge(other *Article) {
+	if other == nil {
+		return
+	}
+
+	mergeString := func(dst *string, v string) {
+		if v != "" {
+			*dst = v
+		}
+	}
+	mergeString(&a.Description, other.Description)
+	mergeString(&a.Image, other.Image)
+	mergeString(&a.Body, other.Body)
+	mergeString(&a.Section, other.Section)
+	mergeString(&a.CanonicalURL, other.CanonicalURL)
+	mergeString(&a.Publisher, other.Publisher)
+
+	if len(other.Authors) > 0 {
+		a.Authors = other.Authors
+	}
+	if len(other.Tags) > 0 {
+		a.Tags = other.Tags
+	}
+	if !other.Published.IsZero() {
+		a.Published = other.Published
+	}
+	if !other.Modified.IsZero() {
+		a.Modified = other.Modified
+	}
+}
+
+// minParagraphLen is the length of shortest text considered as a paragraph of article body
+const minParagraphLen = 25
+
+// excludedContainers are elements which paragraphs are not a part of article body
+const excludedContainers = "nav, header, footer, aside, form, figure, figcaption"
+
+// extractArticle parses HTML page and extracts article data with given extractor
+func extractArticle(page string, extractor Extractor) (*Article, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(page))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML: %w", err)
+	}
+
+	return extractor.Extract(doc)
+}
+
+// metaExtractor is the default extractor, suitable for any site. It extracts article data
+// from OpenGraph, Twitter card and article meta tags, canonical link and the most
+// text-rich block of paragraphs. Fields of schema.org article in JSON-LD are preferred
+// over the ones found in the markup
+type metaExtractor struct{}
+
+// Extract implements Extractor
+func (metaExtractor) Extract(doc *goquery.Document) (*Article, error) {
+	article := &Article{Meta: map[string]string{}}
+	metas := map[string][]string{}
+
+	doc.Find("meta").Each(func(_ int, s *goquery.Selection) {
+		key := strings.ToLower(s.AttrOr("property", s.AttrOr("name", "")))
+		content := strings.TrimSpace(s.AttrOr("content", ""))
+		if key == "" || content == "" {
+			return
+		}
+		metas[key] = append(metas[key], content)
+
+		if isCardProperty(key) {
+			if _, ok := article.Meta[key]; !ok {
+				article.Meta[key] = content
+			}
+		}
+	})
+
+	first := func(keys ...string) string {
+		for _, key := range keys {
+			if v := metas[key]; len(v) > 0 {
+				return v[0]
+			}
+		}
+		return ""
+	}
+
+	article.Description = first("description", "og:description", "twitter:description")
+	article.Image = first("og:image", "og:image:url", "twitter:image", "twitter:image:src")
+	article.Section = first("article:section")
+	article.Published = parseTime(first("article:published_time"))
+	article.Modified = parseTime(first("article:modified_time"))
+
+	article.CanonicalURL = strings.TrimSpace(doc.Find(`link[rel="canonical"]`).First().AttrOr("href", ""))
+	if article.CanonicalURL == "" {
+		article.CanonicalURL = first("og:url")
+	}
+
+	authors := append([]string{}, metas["author"]...)
+	authors = append(authors, metas["article:author"]...)
+	doc.Find(`[rel="author"]`).Each(func(_ int, s *goquery.Selection) {
+		authors = append(authors, s.Text())
+	})
+	article.Authors = uniqueStrings(authors)
+
+	tags := append([]string{}, metas["article:tag"]...)
+	for _, keywords := range metas["keywords"] {
+		tags = append(tags, strings.Split(keywords, ",")...)
+	}
+	article.Tags = uniqueStrings(tags)
+
+	article.Body = extractBody(doc)
+	article.Publisher = first("og:site_name")
+
+	article.merge(extractJSONLD(doc))
+
+	return article, nil
+}
+
+// isCardProperty checks if meta property belongs to OpenGraph, Twitter card or article set
+func isCardProperty(key string) bool {
+	return strings.HasPrefix(key, "og:") || strings.HasPrefix(key, "twitter:") || strings.HasPrefix(key, "article:")
+}
+
+// extractBody finds the element with the most paragraphs text and returns its paragraphs.
+// Every paragraph scores its parent with text length and grandparent with half of it,
+// so both a single block of paragraphs and paragraphs wrapped one by one are found
+func extractBody(doc *goquery.Document) string {
+	scores := map[*html.Node]int{}
+	var best *html.Node
+
+	addScore := func(node *html.Node, score int) {
+		scores[node] += score
+		if best == nil || scores[node] > scores[best] {
+			best = node
+		}
+	}
+
+	doc.Find("p").Each(func(_ int, p *goquery.Selection) {
+		if !isBodyParagraph(p) {
+			return
+		}
+		score := len(strings.TrimSpace(p.Text()))
+
+		parent := p.Parent()
+		if parent.Length() == 0 {
+			return
+		}
+		addScore(parent.Get(0), score)
+
+		if grandparent := parent.Parent(); grandparent.Length() > 0 {
+			addScore(grandparent.Get(0), score/2)
+		}
+	})
+
+	if best == nil {
+		return ""
+	}
+
+	paragraphs := []string{}
+	goquery.NewDocumentFromNode(best).Find("p").Each(func(_ int, p *goquery.Selection) {
+		if isBodyParagraph(p) {
+			paragraphs = append(paragraphs, strings.Join(strings.Fields(p.Text()), " "))
+		}
+	})
+
+	return strings.Join(paragraphs, "\n\n")
+}
+
+// isBodyParagraph checks if paragraph is long enough and is not a part of navigation, captions etc.
+func isBodyParagraph(p *goquery.Selection) bool {
+	return len(strings.TrimSpace(p.Text())) >= minParagraphLen && p.Closest(excludedContainers).Length() == 0
+}
+
+// timeLayouts are formats of article dates, full RFC3339 timestamp or date only
+var timeLayouts = []string{time.RFC3339, "2006-01-02T15:04:05Z0700", "2006-01-02"}
+
+// parseTime parses article time, zero time is returned for invalid value
+func parseTime(s string) time.Time {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// uniqueStrings returns trimmed non-empty strings without duplicates, order is preserved
+func uniqueStrings(values []string) []string {
+	seen := map[string]bool{}
+	result := []string{}
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		result = append(result, v)
+	}
+	return result
+}
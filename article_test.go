@@ -0,0 +1,132 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ExtractArticle(t *testing.T) {
+
+	cases := []struct {
+		name string
+		body string
+		exp  Article
+	}{
+		{"empty", "", Article{}},
+		{"no meta", "<html></html>", Article{}},
+		{"description", `<html>
+		<meta name="description" content="test description">
+		</html>`, Article{Description: "test description"}},
+		{"image", `<html>
+		<meta property="og:image" content="http://example.com/image.jpg">
+		</html>`, Article{Image: "http://example.com/image.jpg",
+			Meta: map[string]string{"og:image": "http://example.com/image.jpg"}}},
+		{"both", `<html>
+		<meta name="description" content="test description">
+		<meta property="og:image" content="http://example.com/image.jpg">
+		</html>`, Article{Description: "test description", Image: "http://example.com/image.jpg",
+			Meta: map[string]string{"og:image": "http://example.com/image.jpg"}}},
+		{"fallbacks", `<html>
+		<meta property="og:description" content="og description">
+		<meta name="twitter:image" content="http://example.com/twitter.jpg">
+		<meta property="og:url" content="http://example.com/article">
+		</html>`, Article{Description: "og description", Image: "http://example.com/twitter.jpg",
+			CanonicalURL: "http://example.com/article",
+			Meta: map[string]string{
+				"og:description": "og description",
+				"twitter:image":  "http://example.com/twitter.jpg",
+				"og:url":         "http://example.com/article",
+			}}},
+		{"article", `<html><head>
+		<link rel="canonical" href="http://example.com/canonical">
+		<meta name="author" content="John Doe">
+		<meta property="article:author" content="Jane Roe">
+		<meta property="article:section" content="World">
+		<meta property="article:tag" content="Politics">
+		<meta property="article:tag" content="Europe">
+		<meta name="keywords" content="Europe, Elections">
+		<meta property="article:published_time" content="2024-07-01T10:00:00Z">
+		<meta property="article:modified_time" content="2024-07-01T12:30:00+01:00">
+		<meta name="twitter:card" content="summary_large_image">
+		</head><body>
+		<nav><p>Home, World, Business, Technology and other sections</p></nav>
+		<article>
+			<header><p>This is a header paragraph, not a body one</p></header>
+			<div><p>First paragraph of the article  body text.</p></div>
+			<div><p>Second paragraph of the article body text.</p></div>
+			<figure><figcaption><p>Image caption is not a part of the body</p></figcaption></figure>
+			<div><p>Short one.</p></div>
+			<div><p>Third paragraph of the article body text.</p></div>
+		</article>
+		<footer><p>Copyright footer paragraph is not a part of the body</p></footer>
+		</body></html>`, Article{
+			Body: strings.Join([]string{
+				"First paragraph of the article body text.",
+				"Second paragraph of the article body text.",
+				"Third paragraph of the article body text.",
+			}, "\n\n"),
+			Authors:      []string{"John Doe", "Jane Roe"},
+			Section:      "World",
+			Tags:         []string{"Politics", "Europe", "Elections"},
+			CanonicalURL: "http://example.com/canonical",
+			Published:    time.Date(2024, 7, 1, 10, 0, 0, 0, time.UTC),
+			Modified:     time.Date(2024, 7, 1, 11, 30, 0, 0, time.UTC),
+			Meta: map[string]string{
+				"article:author":         "Jane Roe",
+				"article:section":        "World",
+				"article:tag":            "Politics",
+				"article:published_time": "2024-07-01T10:00:00Z",
+				"article:modified_time":  "2024-07-01T12:30:00+01:00",
+				"twitter:card":           "summary_large_image",
+			},
+		}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			article, err := extractArticle(tc.body, metaExtractor{})
+			assert.NoError(t, err)
+
+			assert.Equal(t, tc.exp.Description, article.Description)
+			assert.Equal(t, tc.exp.Image, article.Image)
+			assert.Equal(t, tc.exp.Body, article.Body)
+			assert.ElementsMatch(t, tc.exp.Authors, article.Authors)
+			assert.Equal(t, tc.exp.Section, article.Section)
+			assert.ElementsMatch(t, tc.exp.Tags, article.Tags)
+			assert.Equal(t, tc.exp.CanonicalURL, article.CanonicalURL)
+			assert.True(t, tc.exp.Published.Equal(article.Published))
+			assert.True(t, tc.exp.Modified.Equal(article.Modified))
+			if tc.exp.Meta == nil {
+				assert.Empty(t, article.Meta)
+			} else {
+				assert.Equal(t, tc.exp.Meta, article.Meta)
+			}
+		})
+	}
+}
+
+func Test_ArticleApplyTo(t *testing.T) {
+	item := NewsItem{Title: "title", Link: "link", Description: "rss description"}
+
+	// empty article changes nothing
+	applied := (&Article{}).applyTo(&item)
+	assert.Equal(t, 0, applied)
+	assert.Equal(t, "rss description", item.Description)
+
+	article := Article{
+		Description: "description",
+		Image:       "image",
+		Tags:        []string{"tag"},
+		Modified:    time.Now(),
+	}
+	applied = article.applyTo(&item)
+	assert.Equal(t, 4, applied)
+	assert.Equal(t, "description", item.Description)
+	assert.Equal(t, "image", item.Image)
+	assert.Equal(t, []string{"tag"}, item.Tags)
+	assert.Equal(t, &article.Modified, item.ArticleModified)
+	assert.Empty(t, item.Authors)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// trackingParams are query parameters of campaign and click tracking, they don't change the page
+var trackingParams = map[string]bool{
+	"fbclid": true, "gclid": true, "dclid": true, "msclkid": true, "yclid": true, "igshid": true,
+	"mc_cid": true, "mc_eid": true, "ocid": true, "cmpid": true, "ito": true, "ref_src": true, "_ga": true,
+}
+
+// trackingPrefixes are prefixes of tracking parameter families, e.g. utm_source or BBC at_medium
+var trackingPrefixes = []string{"utm_", "at_", "ns_"}
+
+// canonicalLink normalizes news link to find the same article under different links: scheme and host
+// are lower-cased, http is upgraded to https, default port, fragment and tracking parameters are removed
+// and the rest of parameters are sorted. Links that are not absolute http(s) URLs are returned as they are
+func canonicalLink(link string) string {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil || u.Host == "" {
+		return link
+	}
+	if scheme := strings.ToLower(u.Scheme); scheme != "http" && scheme != "https" {
+		return link
+	}
+	u.Scheme = "https"
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	switch port := u.Port(); {
+	case port != "" && port != "80" && port != "443":
+		host = net.JoinHostPort(host, port)
+	case strings.Contains(host, ":"): // IPv6 address
+		host = "[" + host + "]"
+	}
+	u.Host = host
+
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	u.Fragment, u.RawFragment = "", ""
+
+	query := u.Query()
+	for param := range query {
+		if isTrackingParam(param) {
+			query.Del(param)
+		}
+	}
+	u.RawQuery = query.Encode() // sorted by key
+	u.ForceQuery = false
+
+	return u.String()
+}
+
+// isTrackingParam checks if query parameter is used for tracking only
+func isTrackingParam(param string) bool {
+	param = strings.ToLower(param)
+	if trackingParams[param] {
+		return true
+	}
+	for _, prefix := range trackingPrefixes {
+		if strings.HasPrefix(param, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// articleLink returns canonical link of the article page found on enrichment, relative to the item link,
+// or empty string if there is none
+func articleLink(item NewsItem) string {
+	if item.CanonicalURL == "" {
+		return ""
+	}
+	base, err := url.Parse(item.Link)
+	if err != nil {
+		return canonicalLink(item.CanonicalURL)
+	}
+	ref, err := url.Parse(strings.TrimSpace(item.CanonicalURL))
+	if err != nil {
+		return ""
+	}
+	return canonicalLink(base.ResolveReference(ref).String())
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_CanonicalLink(t *testing.T) {
+	cases := []struct {
+		name string
+		link string
+		want string
+	}{
+		{
+			name: "bbc tracking",
+			link: "https://www.bbc.com/news/articles/c1?at_medium=RSS&at_campaign=rss",
+			want: "https://www.bbc.com/news/articles/c1",
+		},
+		{
+			name: "utm and click ids",
+			link: "https://example.com/story?id=42&utm_source=twitter&UTM_MEDIUM=social&fbclid=abc",
+			want: "https://example.com/story?id=42",
+		},
+		{name: "fragment", link: "https://example.com/story#comments", want: "https://example.com/story"},
+		{name: "scheme and host", link: "HTTP://WWW.Example.COM./Story", want: "https://www.example.com/Story"},
+		{name: "default port", link: "http://example.com:80/story", want: "https://example.com/story"},
+		{name: "custom port", link: "http://example.com:8080/story", want: "https://example.com:8080/story"},
+		{name: "empty path", link: "https://example.com?utm_source=x", want: "https://example.com/"},
+		{name: "sorted params", link: "https://example.com/story?b=2&a=1&a=0", want: "https://example.com/story?a=1&a=0&b=2"},
+		{name: "ipv6", link: "http://[::1]/story", want: "https://[::1]/story"},
+		{name: "relative", link: "news/story?utm_source=x", want: "news/story?utm_source=x"},
+		{name: "not http", link: "ftp://example.com/story", want: "ftp://example.com/story"},
+		{name: "invalid", link: "https://exa mple.com/%zz", want: "https://exa mple.com/%zz"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, canonicalLink(tc.link))
+		})
+	}
+}
+
+func Test_ArticleLink(t *testing.T) {
+	cases := []struct {
+		name string
+		item NewsItem
+		want string
+	}{
+		{
+			name: "no canonical url",
+			item: NewsItem{Link: "https://www.bbc.com/news/articles/c1?at_medium=RSS"},
+			want: "",
+		},
+		{
+			name: "absolute canonical url",
+			item: NewsItem{Link: "https://www.bbc.com/news/articles/c1?at_medium=RSS", CanonicalURL: "https://www.bbc.co.uk/news/world-1"},
+			want: "https://www.bbc.co.uk/news/world-1",
+		},
+		{
+			name: "relative canonical url",
+			item: NewsItem{Link: "https://www.bbc.com/news/articles/c1?at_medium=RSS", CanonicalURL: " /news/world-1?utm_source=x "},
+			want: "https://www.bbc.com/news/world-1",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, articleLink(tc.item))
+		})
+	}
+}
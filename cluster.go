@@ -0,0 +1,98 @@
+package main
+
+import (
+	"hash/fnv"
+	"math/bits"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// The same story comes from different feeds with different links and slightly different headlines.
+// Such items are detected by SimHash fingerprints of title and description, which differ in a few bits
+// for texts sharing most of the words, and put to the same story cluster
+
+const (
+	clusterMaxDistance = 12             // max number of different fingerprint bits of the same story, of 64
+	clusterWindow      = 48 * time.Hour // max difference of publication time of the same story
+)
+
+// stopWords are not counted as features of the text, rewrites of the same story differ in them the most
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "by": true,
+	"for": true, "from": true, "has": true, "have": true, "in": true, "is": true, "it": true, "its": true,
+	"of": true, "on": true, "or": true, "that": true, "the": true, "to": true, "was": true, "were": true,
+	"will": true, "with": true,
+}
+
+// fingerprint returns SimHash of the news item title and description
+func fingerprint(item NewsItem) uint64 {
+	return simhash(item.Title + " " + item.Description)
+}
+
+// simhash returns 64-bit SimHash of the words of the text: every bit is set if it is set
+// in the most of the word hashes. Empty text has zero fingerprint
+func simhash(text string) uint64 {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	var weights [64]int
+	for _, word := range words {
+		if stopWords[word] {
+			continue
+		}
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(word))
+		sum := h.Sum64()
+		for i := range weights {
+			if sum&(1<<i) != 0 {
+				weights[i]++
+			} else {
+				weights[i]--
+			}
+		}
+	}
+
+	var fp uint64
+	for i, w := range weights {
+		if w > 0 {
+			fp |= 1 << i
+		}
+	}
+	return fp
+}
+
+// hammingDistance returns number of different bits of the fingerprints
+func hammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// storyFingerprint is the fingerprint of saved news item with its story cluster
+type storyFingerprint struct {
+	ID          int
+	Published   time.Time
+	Fingerprint uint64
+	ClusterID   int
+}
+
+// nearestCluster returns story cluster of the nearest fingerprint published within clusterWindow
+// from the item, or the item ID and false if there are none closer than clusterMaxDistance
+func nearestCluster(candidates []storyFingerprint, item storyFingerprint) (int, bool) {
+	cluster, best := item.ID, clusterMaxDistance+1
+	if item.Fingerprint == 0 {
+		return cluster, false
+	}
+	for _, c := range candidates {
+		if c.ID == item.ID || c.Fingerprint == 0 {
+			continue
+		}
+		if d := c.Published.Sub(item.Published); d > clusterWindow || d < -clusterWindow {
+			continue
+		}
+		if dist := hammingDistance(c.Fingerprint, item.Fingerprint); dist < best {
+			cluster, best = c.ClusterID, dist
+		}
+	}
+	return cluster, best <= clusterMaxDistance
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Simhash(t *testing.T) {
+	cases := []struct {
+		name    string
+		a, b    string
+		similar bool
+	}{
+		{
+			name:    "the same words",
+			a:       "Fire breaks out at Notre-Dame cathedral in Paris",
+			b:       "Notre-Dame cathedral in Paris: fire breaks out",
+			similar: true,
+		},
+		{
+			name:    "rewritten headline",
+			a:       "Fire breaks out at Notre-Dame cathedral in Paris. Firefighters are battling a large blaze at the cathedral in the centre of the French capital",
+			b:       "Huge fire breaks out at Notre-Dame cathedral in Paris. Firefighters are battling a large blaze at the cathedral in the centre of the French capital.",
+			similar: true,
+		},
+		{
+			name:    "rewritten description",
+			a:       "UK inflation falls to 2% for the first time in three years. The rate of price rises eased in May, official figures show",
+			b:       "UK inflation falls to 2% for first time in three years. Price rises eased in May, according to official figures",
+			similar: true,
+		},
+		{
+			name: "another story",
+			a:    "UK inflation falls to 2% for the first time in three years. The rate of price rises eased in May, official figures show",
+			b:    "Earthquake strikes off Japan coast, tsunami warning issued. Residents of coastal areas were told to move to higher ground",
+		},
+		{
+			name: "description of another story",
+			a:    "Fire breaks out at Notre-Dame cathedral in Paris",
+			b:    "Notre-Dame cathedral in Paris: fire breaks out. Scientists announce a breakthrough in battery chemistry, promising cheaper electric cars",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dist := hammingDistance(simhash(tc.a), simhash(tc.b))
+			if tc.similar {
+				assert.LessOrEqual(t, dist, clusterMaxDistance)
+				return
+			}
+			assert.Greater(t, dist, clusterMaxDistance)
+		})
+	}
+
+	assert.Zero(t, simhash(""))
+	assert.Zero(t, simhash("the, and - of"))
+	assert.Equal(t, simhash("Fire in Paris"), simhash("FIRE in paris!"))
+}
+
+func Test_NearestCluster(t *testing.T) {
+	published := time.Date(2024, 7, 1, 10, 0, 0, 0, time.UTC)
+	fp := simhash("Fire breaks out at Notre-Dame cathedral in Paris")
+	candidates := []storyFingerprint{
+		{ID: 1, Published: published, Fingerprint: simhash("Earthquake strikes off Japan coast"), ClusterID: 1},
+		{ID: 2, Published: published, Fingerprint: fp ^ 0b111, ClusterID: 2},
+		{ID: 3, Published: published, Fingerprint: fp ^ 0b1, ClusterID: 2},
+		{ID: 4, Published: published.Add(-clusterWindow - time.Hour), Fingerprint: fp, ClusterID: 4},
+	}
+
+	cases := []struct {
+		name    string
+		item    storyFingerprint
+		want    int
+		matched bool
+	}{
+		{name: "nearest", item: storyFingerprint{ID: 5, Published: published, Fingerprint: fp}, want: 2, matched: true},
+		{name: "itself", item: storyFingerprint{ID: 3, Published: published, Fingerprint: fp ^ 0b1}, want: 2, matched: true},
+		{name: "out of window", item: storyFingerprint{ID: 5, Published: published.Add(-2 * clusterWindow), Fingerprint: fp}, want: 4, matched: true},
+		{name: "no match", item: storyFingerprint{ID: 5, Published: published, Fingerprint: ^fp}, want: 5},
+		{name: "no text", item: storyFingerprint{ID: 5, Published: published}, want: 5},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cluster, matched := nearestCluster(candidates, tc.item)
+			assert.Equal(t, tc.want, cluster)
+			assert.Equal(t, tc.matched, matched)
+		})
+	}
+}
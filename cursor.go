@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// ErrInvalidCursor is returned for cursors not issued by the listing
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor points to the boundary item of a listing page, the page starts after the item in the listing
+// order, or ends before it for the backward cursor. Clients get it encoded as an opaque string
+type Cursor struct {
+	Sort      string    `json:"s"`           // listing order the cursor is issued for
+	Rank      float64   `json:"r,omitempty"` // search rank, for relevance order
+	Published time.Time `json:"p"`
+	ID        int       `json:"i"`
+	Backward  bool      `json:"b,omitempty"` // page before the item
+}
+
+// IsZero reports whether the cursor is not set, it points to the first page then
+func (c Cursor) IsZero() bool {
+	return c.ID == 0
+}
+
+// Encode returns opaque URL-safe representation of the cursor
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c) //nolint:errcheck // plain struct can't fail to marshal
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor decodes cursor returned by Encode, empty string is the zero cursor
+func DecodeCursor(s string) (Cursor, error) {
+	c := Cursor{}
+	if s == "" {
+		return c, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(data, &c); err != nil || c.ID < 1 {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+// pageMetadata returns metadata with cursors of the pages around the items fetched with the filters,
+// more is set if there are items past the page in the fetching direction
+func pageMetadata(items []NewsItem, ranks []float64, filters Filters, more bool) Metadata {
+	meta := Metadata{PageSize: filters.PageSize}
+	if len(items) == 0 {
+		return meta
+	}
+
+	// moving backward, there are items after the page, the ones the cursor came from
+	c := filters.Cursor
+	hasNext, hasPrev := more, !c.IsZero()
+	if c.Backward {
+		hasNext, hasPrev = !c.IsZero(), more
+	}
+
+	sort, last := filters.sortOrder(), len(items)-1
+	if hasNext {
+		meta.Next = Cursor{Sort: sort, Rank: ranks[last], Published: items[last].Published, ID: items[last].ID}.Encode()
+	}
+	if hasPrev {
+		meta.Prev = Cursor{Sort: sort, Rank: ranks[0], Published: items[0].Published, ID: items[0].ID, Backward: true}.Encode()
+	}
+
+	return meta
+}
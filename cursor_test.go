@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Cursor(t *testing.T) {
+	c := Cursor{Sort: SortRelevance, Rank: 0.0607927, Published: time.Date(2024, 7, 1, 10, 0, 0, 123456000, time.UTC), ID: 42, Backward: true}
+
+	decoded, err := DecodeCursor(c.Encode())
+	assert.NoError(t, err)
+	assert.Equal(t, c.Sort, decoded.Sort)
+	assert.Equal(t, c.Rank, decoded.Rank)
+	assert.True(t, c.Published.Equal(decoded.Published))
+	assert.Equal(t, c.ID, decoded.ID)
+	assert.True(t, decoded.Backward)
+
+	decoded, err = DecodeCursor("")
+	assert.NoError(t, err)
+	assert.True(t, decoded.IsZero())
+
+	for _, s := range []string{"not a cursor", "bm90IGpzb24", "e30"} {
+		_, err = DecodeCursor(s)
+		assert.ErrorIs(t, err, ErrInvalidCursor, s)
+	}
+}
+
+func Test_PageMetadata(t *testing.T) {
+	published := time.Date(2024, 7, 1, 10, 0, 0, 0, time.UTC)
+	items := []NewsItem{{ID: 3, Published: published}, {ID: 2, Published: published}}
+	ranks := []float64{0, 0}
+	next := Cursor{Sort: SortPublishedDesc, Published: published, ID: 2}.Encode()
+	prev := Cursor{Sort: SortPublishedDesc, Published: published, ID: 3, Backward: true}.Encode()
+
+	cases := []struct {
+		name   string
+		cursor Cursor
+		more   bool
+		want   Metadata
+	}{
+		{name: "single page", want: Metadata{PageSize: 2}},
+		{name: "first page", more: true, want: Metadata{PageSize: 2, Next: next}},
+		{name: "middle page", cursor: Cursor{ID: 4}, more: true, want: Metadata{PageSize: 2, Next: next, Prev: prev}},
+		{name: "last page", cursor: Cursor{ID: 4}, want: Metadata{PageSize: 2, Prev: prev}},
+		{name: "back to the first page", cursor: Cursor{ID: 1, Backward: true}, want: Metadata{PageSize: 2, Next: next}},
+		{name: "back to the middle page", cursor: Cursor{ID: 1, Backward: true}, more: true, want: Metadata{PageSize: 2, Next: next, Prev: prev}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, pageMetadata(items, ranks, Filters{PageSize: 2, Cursor: tc.cursor}, tc.more))
+		})
+	}
+
+	assert.Equal(t, Metadata{PageSize: 2}, pageMetadata([]NewsItem{}, nil, Filters{PageSize: 2, Cursor: Cursor{ID: 1}}, false))
+}
@@ -1,72 +1,169 @@
 package main
 
 import (
-	"math"
+	"strings"
 	"time"
 )
 
 // NewsItem represents news item
 type NewsItem struct {
-	ID          int
-	Title       string
-	Link        string
-	Published   time.Time
-	Description string
-	Image       string
+	ID            int       `json:"id"`
+	Title         string    `json:"title"`
+	Link          string    `json:"link"`
+	CanonicalLink string    `json:"canonical_link,omitempty"` // normalized link, the item is deduplicated by it and ArticleLink
+	ArticleLink   string    `json:"article_link,omitempty"`   // normalized canonical link of the article page, set on enrichment
+	Published     time.Time `json:"published"`
+	Description   string    `json:"description"`
+	Image         string    `json:"image"`
+	FeedID        int       `json:"feed_id,omitempty"`
+	Snippet       string    `json:"snippet,omitempty"` // search match highlights, filled for search results only
+
+	// article data extracted from the page on enrichment
+	Body             string            `json:"body,omitempty"`
+	Authors          []string          `json:"authors,omitempty"`
+	Section          string            `json:"section,omitempty"`
+	Tags             []string          `json:"tags,omitempty"`
+	CanonicalURL     string            `json:"canonical_url,omitempty"`
+	Publisher        string            `json:"publisher,omitempty"`
+	ArticlePublished *time.Time        `json:"article_published,omitempty"`
+	ArticleModified  *time.Time        `json:"article_modified,omitempty"`
+	Meta             map[string]string `json:"meta,omitempty"` // og:*, twitter:* and article:* properties
+
+	// outcome of the last enrichment
+	EnrichmentStatus   string     `json:"enrichment_status,omitempty"`
+	EnrichmentAttempts int        `json:"enrichment_attempts,omitempty"` // all attempts made, failed included
+	EnrichedAt         *time.Time `json:"enriched_at,omitempty"`         // last successful enrichment, nil if none
+	LastError          string     `json:"-"`                             // error of the last failed attempt, admin API only
+
+	Revisions int `json:"revisions,omitempty"` // number of recorded changes, filled for single item only
+
+	// near-duplicate items of other sources are put to the same story cluster
+	ClusterID int `json:"story_cluster_id,omitempty"`
+	Related   int `json:"related,omitempty"` // number of other items of the story, filled for collapsed listing only
 }
 
-type Metadata struct {
-	CurrentPage  int `json:"current_page,omitempty"`
-	PageSize     int `json:"page_size,omitempty"`
-	FirstPage    int `json:"first_page,omitempty"`
-	LastPage     int `json:"last_page,omitempty"`
-	TotalRecords int `json:"total_records,omitempty"`
+// NewsRevision is a previous version of news item title and publication time, replaced at ChangedAt
+type NewsRevision struct {
+	ID        int64     `json:"id"`
+	NewsID    int       `json:"news_id"`
+	Title     string    `json:"title"`
+	Published time.Time `json:"published"`
+	ChangedAt time.Time `json:"changed_at"`
 }
 
-// calculateMetadata calculates metadata for pagination
-func calculateMetadata(totalRecords, page, pageSize int) Metadata {
-	if totalRecords == 0 {
-		return Metadata{}
-	}
+// Enrichment statuses of news item
+const (
+	EnrichmentPending = "pending" // not enriched yet
+	EnrichmentSuccess = "success"
+	EnrichmentFailed  = "failed"
+)
 
-	return Metadata{
-		CurrentPage:  page,
-		PageSize:     pageSize,
-		FirstPage:    1,
-		LastPage:     int(math.Ceil(float64(totalRecords) / float64(pageSize))),
-		TotalRecords: totalRecords,
-	}
+// Feed represents RSS feed subscription
+type Feed struct {
+	ID      int
+	URL     string
+	Title   string
+	TTL     time.Duration
+	Enabled bool
+	// validators of the last fetched feed version, used for conditional requests
+	ETag         string
+	LastModified string
+}
+
+// FeedValidators are HTTP validators of the fetched feed version, sent back with conditional requests
+type FeedValidators struct {
+	ETag         string
+	LastModified string
+}
+
+// Metadata is the listing page metadata, with opaque cursors of the adjacent pages
+type Metadata struct {
+	PageSize int    `json:"page_size,omitempty"`
+	Next     string `json:"next,omitempty"` // empty on the last page
+	Prev     string `json:"prev,omitempty"` // empty on the first page
 }
 
 // Filters represents filters for news items
-// ?page=1&pagesize=5
+// ?cursor=...&pagesize=5&feed=1&q=search+terms&from=2024-07-01&to=2024-07-31&has_image=true&has_description=true
+// &sort=published_asc&collapse=true&cluster=1&enrichment=failed&attempts=3
 type Filters struct {
-	Page     int
-	PageSize int
+	Cursor           Cursor // page boundary, zero for the first page
+	PageSize         int
+	FeedID           int       // 0 means all feeds
+	Query            string    // full-text search query
+	From             time.Time // published at or after, zero means no limit
+	To               time.Time // published before, zero means no limit
+	HasImage         *bool     // with or without image, nil means any
+	HasDescription   *bool     // with or without description, nil means any
+	Sort             string    // listing order, empty for relevance of search results and the latest first otherwise
+	Collapse         bool      // only the latest item of every story cluster, with the number of related ones
+	ClusterID        int       // items of the story cluster, 0 means all
+	EnrichmentStatus string    // empty means any status
+	MinAttempts      int       // enrichment attempts at least, 0 means no limit
+}
+
+// Sort orders of news listing
+const (
+	SortPublishedDesc = "published_desc"
+	SortPublishedAsc  = "published_asc"
+	SortRelevance     = "relevance" // search rank, then the latest first
+)
+
+// ReenrichFilter selects news items to be enriched again, zero values mean no condition
+type ReenrichFilter struct {
+	ID    int       // single news item
+	From  time.Time // published at or after
+	To    time.Time // published before
+	Limit int       // max number of items
+
+	// used by the scheduler to pick stale and incomplete items
+	EnrichedBefore  time.Time // items missing description or image, never enriched or enriched before this
+	RequestedBefore time.Time // items not requested for enrichment since this
 }
 
 var defaultFilters = Filters{
-	Page:     1,
 	PageSize: 5,
 }
 
 // validate validates filters and sets default values if needed
 func (f *Filters) validate(defaultFilters Filters) {
-	if f.Page < 1 {
-		f.Page = defaultFilters.Page
-	}
 	if f.PageSize < 1 {
 		f.PageSize = defaultFilters.PageSize
 	}
+	if f.FeedID < 0 {
+		f.FeedID = defaultFilters.FeedID
+	}
+	if f.ClusterID < 0 {
+		f.ClusterID = defaultFilters.ClusterID
+	}
+	f.Query = strings.TrimSpace(f.Query)
+	switch f.Sort {
+	case "", SortPublishedDesc, SortPublishedAsc, SortRelevance:
+	default:
+		f.Sort = defaultFilters.Sort
+	}
+	switch f.EnrichmentStatus {
+	case "", EnrichmentPending, EnrichmentSuccess, EnrichmentFailed:
+	default:
+		f.EnrichmentStatus = defaultFilters.EnrichmentStatus
+	}
+	if f.MinAttempts < 0 {
+		f.MinAttempts = defaultFilters.MinAttempts
+	}
+}
+
+// sortOrder returns the listing order, relevance applies to search results only
+func (f Filters) sortOrder() string {
+	switch {
+	case f.Sort == "" && f.Query != "":
+		return SortRelevance
+	case f.Sort == "", f.Sort == SortRelevance && f.Query == "":
+		return SortPublishedDesc
+	}
+	return f.Sort
 }
 
 // limit returns limit for SQL query
 func (f Filters) limit() int {
 	return f.PageSize
 }
-
-// offset returns offset for SQL query
-func (f Filters) offset() int {
-	offset := (f.Page - 1) * f.PageSize
-	return min(offset, math.MaxInt)
-}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+	"gopkg.in/yaml.v3"
+)
+
+// Extractor extracts article data from the parsed page
+type Extractor interface {
+	Extract(doc *goquery.Document) (*Article, error)
+}
+
+// ExtractorRule describes site-specific extraction for pages of matching hosts.
+// Fields are extracted with CSS selectors on top of the default extractor,
+// empty selector or no matches leave the value found by the default one
+type ExtractorRule struct {
+	Name    string   `yaml:"name"`
+	Hosts   []string `yaml:"hosts"`   // host patterns in path.Match syntax, e.g. "*.bbc.co.uk"
+	Exclude string   `yaml:"exclude"` // elements removed from the page before extraction
+	Body    string   `yaml:"body"`    // body paragraphs
+	Authors string   `yaml:"authors"`
+	Section string   `yaml:"section"`
+	Tags    string   `yaml:"tags"`
+	Image   string   `yaml:"image"` // img element, src attribute is taken
+}
+
+// builtinRules are extractor rules for the sites we ingest, rules loaded from file take precedence
+var builtinRules = []ExtractorRule{
+	{
+		Name:    "bbc",
+		Hosts:   []string{"bbc.co.uk", "*.bbc.co.uk", "bbc.com", "*.bbc.com"},
+		Exclude: `[data-component="links-block"], [data-component="image-block"]`,
+		Body:    `article [data-component="text-block"] p`,
+		Authors: `[data-testid="byline-new-contributors"] span:first-child`,
+		Tags:    `[data-component="topic-list"] a, [data-component="tags"] a`,
+	},
+	{
+		Name:    "reuters",
+		Hosts:   []string{"reuters.com", "*.reuters.com"},
+		Body:    `[data-testid^="paragraph-"]`,
+		Authors: `[rel="author"], [data-testid="AuthorName"]`,
+		Section: `[data-testid="Label"] a`,
+	},
+}
+
+// LoadExtractorRules reads list of extractor rules from YAML (or JSON, as a subset of YAML) file,
+// see extractors.example.yml. Host patterns and selectors are validated
+func LoadExtractorRules(file string) ([]ExtractorRule, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read extractor rules: %w", err)
+	}
+
+	rules := []ExtractorRule{}
+	err = yaml.Unmarshal(data, &rules)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse extractor rules: %w", err)
+	}
+
+	for _, rule := range rules {
+		if len(rule.Hosts) == 0 {
+			return nil, fmt.Errorf("extractor rule %q has no hosts", rule.Name)
+		}
+		for _, pattern := range rule.Hosts {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("extractor rule %q has invalid host pattern %q: %w", rule.Name, pattern, err)
+			}
+		}
+		for _, selector := range []string{rule.Exclude, rule.Body, rule.Authors, rule.Section, rule.Tags, rule.Image} {
+			if selector == "" {
+				continue
+			}
+			if _, err := cascadia.ParseGroup(selector); err != nil {
+				return nil, fmt.Errorf("extractor rule %q has invalid selector %q: %w", rule.Name, selector, err)
+			}
+		}
+	}
+
+	return rules, nil
+}
+
+// Extractors selects extractor by the host of the page link.
+// nil *Extractors always selects the default extractor
+type Extractors struct {
+	rules []ruleExtractor
+	def   Extractor
+}
+
+// NewExtractors creates extractors for given rules followed by the builtin ones,
+// first matching rule is used
+func NewExtractors(rules []ExtractorRule) *Extractors {
+	e := &Extractors{def: metaExtractor{}}
+	for _, rule := range append(rules, builtinRules...) {
+		e.rules = append(e.rules, ruleExtractor{rule: rule, base: e.def})
+	}
+
+	return e
+}
+
+// For returns extractor for given link, default extractor is returned if no rule matches
+func (e *Extractors) For(link string) Extractor {
+	if e == nil {
+		return metaExtractor{}
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		return e.def
+	}
+	host := strings.ToLower(u.Hostname())
+
+	for _, r := range e.rules {
+		for _, pattern := range r.rule.Hosts {
+			if ok, _ := path.Match(pattern, host); ok {
+				return r
+			}
+		}
+	}
+
+	return e.def
+}
+
+// ruleExtractor extracts article data with the base extractor and the rule selectors
+type ruleExtractor struct {
+	rule ExtractorRule
+	base Extractor
+}
+
+// Extract implements Extractor
+func (r ruleExtractor) Extract(doc *goquery.Document) (*Article, error) {
+	article, err := r.base.Extract(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.rule.Exclude != "" {
+		doc.Find(r.rule.Exclude).Remove()
+	}
+
+	if paragraphs := selectTexts(doc, r.rule.Body); len(paragraphs) > 0 {
+		article.Body = strings.Join(paragraphs, "\n\n")
+	}
+	if authors := uniqueStrings(selectTexts(doc, r.rule.Authors)); len(authors) > 0 {
+		article.Authors = authors
+	}
+	if section := selectTexts(doc, r.rule.Section); len(section) > 0 {
+		article.Section = section[0]
+	}
+	if tags := uniqueStrings(selectTexts(doc, r.rule.Tags)); len(tags) > 0 {
+		article.Tags = tags
+	}
+	if r.rule.Image != "" {
+		if src := strings.TrimSpace(doc.Find(r.rule.Image).First().AttrOr("src", "")); src != "" {
+			article.Image = src
+		}
+	}
+
+	return article, nil
+}
+
+// selectTexts returns whitespace-normalized non-empty texts of elements matching selector
+func selectTexts(doc *goquery.Document, selector string) []string {
+	texts := []string{}
+	if selector == "" {
+		return texts
+	}
+
+	doc.Find(selector).Each(func(_ int, s *goquery.Selection) {
+		if text := strings.Join(strings.Fields(s.Text()), " "); text != "" {
+			texts = append(texts, text)
+		}
+	})
+
+	return texts
+}
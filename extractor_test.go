@@ -0,0 +1,135 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ExtractorsFor(t *testing.T) {
+	e := NewExtractors([]ExtractorRule{
+		{Name: "custom", Hosts: []string{"*.example.com"}},
+		{Name: "bbc-override", Hosts: []string{"www.bbc.com"}},
+	})
+
+	cases := []struct {
+		link string
+		rule string // empty for default extractor
+	}{
+		{"https://www.bbc.co.uk/news/world-1", "bbc"},
+		{"https://bbc.co.uk/news/world-1", "bbc"},
+		{"https://WWW.BBC.CO.UK/news/world-1", "bbc"},
+		{"https://www.bbc.com/news/world-1", "bbc-override"}, // loaded rules take precedence
+		{"https://www.reuters.com/world/1", "reuters"},
+		{"https://news.example.com/1", "custom"},
+		{"https://example.com/1", ""}, // *. requires subdomain
+		{"https://www.notbbc.co.uk/1", ""},
+		{"error", ""},
+		{"", ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.link, func(t *testing.T) {
+			extractor := e.For(tc.link)
+			if tc.rule == "" {
+				assert.Equal(t, metaExtractor{}, extractor)
+				return
+			}
+			assert.IsType(t, ruleExtractor{}, extractor)
+			assert.Equal(t, tc.rule, extractor.(ruleExtractor).rule.Name)
+		})
+	}
+
+	// nil extractors select default
+	var none *Extractors
+	assert.Equal(t, metaExtractor{}, none.For("https://www.bbc.co.uk/news/world-1"))
+}
+
+func Test_RuleExtractor(t *testing.T) {
+	page := `<html><head>
+	<meta name="description" content="test description">
+	<meta property="og:image" content="http://example.com/image.jpg">
+	<meta property="article:section" content="World">
+	</head><body>
+	<article>
+		<div data-component="text-block"><p>First   paragraph.</p></div>
+		<div data-component="links-block"><div data-component="text-block"><p>Related link</p></div></div>
+		<div data-component="text-block"><p>Second paragraph.</p></div>
+		<div data-testid="byline-new-contributors"><span>John Doe</span><span>BBC News</span></div>
+	</article>
+	<div data-component="topic-list"><a>Politics</a><a>Europe</a><a>Politics</a></div>
+	</body></html>`
+
+	article, err := extractArticle(page, NewExtractors(nil).For("https://www.bbc.co.uk/news/world-1"))
+	assert.NoError(t, err)
+
+	// meta data from the default extractor
+	assert.Equal(t, "test description", article.Description)
+	assert.Equal(t, "http://example.com/image.jpg", article.Image)
+	assert.Equal(t, "World", article.Section)
+
+	// site-specific selectors, excluded blocks are skipped
+	assert.Equal(t, "First paragraph.\n\nSecond paragraph.", article.Body)
+	assert.Equal(t, []string{"John Doe"}, article.Authors)
+	assert.Equal(t, []string{"Politics", "Europe"}, article.Tags)
+
+	// custom image selector
+	rule := ExtractorRule{Name: "custom", Hosts: []string{"example.com"}, Image: "img.lead"}
+	article, err = extractArticle(`<html><body><img class="lead" src="lead.jpg"></body></html>`,
+		ruleExtractor{rule: rule, base: metaExtractor{}})
+	assert.NoError(t, err)
+	assert.Equal(t, "lead.jpg", article.Image)
+}
+
+func Test_LoadExtractorRules(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		file := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(file, []byte(content), 0o600))
+		return file
+	}
+
+	// YAML
+	rules, err := LoadExtractorRules(write("rules.yml", `
+- name: example
+  hosts: ["example.com", "*.example.com"]
+  body: "div.story p"
+  authors: ".byline"
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, []ExtractorRule{{
+		Name:    "example",
+		Hosts:   []string{"example.com", "*.example.com"},
+		Body:    "div.story p",
+		Authors: ".byline",
+	}}, rules)
+
+	// JSON
+	rules, err = LoadExtractorRules(write("rules.json",
+		`[{"name": "example", "hosts": ["example.com"], "tags": ".tags a"}]`))
+	assert.NoError(t, err)
+	assert.Equal(t, []ExtractorRule{{Name: "example", Hosts: []string{"example.com"}, Tags: ".tags a"}}, rules)
+
+	// example file in the repo is valid
+	rules, err = LoadExtractorRules("extractors.example.yml")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, rules)
+
+	// errors
+	_, err = LoadExtractorRules(filepath.Join(dir, "missing.yml"))
+	assert.Error(t, err)
+
+	_, err = LoadExtractorRules(write("invalid.yml", "name: not a list"))
+	assert.Error(t, err)
+
+	_, err = LoadExtractorRules(write("no_hosts.yml", `[{"name": "example"}]`))
+	assert.Error(t, err)
+
+	_, err = LoadExtractorRules(write("bad_pattern.yml", `[{"name": "example", "hosts": ["[example.com"]}]`))
+	assert.Error(t, err)
+
+	_, err = LoadExtractorRules(write("bad_selector.yml", `[{"name": "example", "hosts": ["example.com"], "body": "div["}]`))
+	assert.Error(t, err)
+}
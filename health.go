@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// ReadyCheck checks a dependency of the service, returns error if it is not ready
+type ReadyCheck func(ctx context.Context) error
+
+// namedCheck is a readiness check with the dependency name
+type namedCheck struct {
+	name  string
+	check ReadyCheck
+}
+
+// checkResult is a readiness check outcome of the dependency
+type checkResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// readyCheckTimeout limits every readiness check, probes should answer fast
+const readyCheckTimeout = 2 * time.Second
+
+// AddReadyCheck registers readiness check of the dependency, reported under given name on /readyz
+func (api *APIServer) AddReadyCheck(name string, check ReadyCheck) {
+	api.checks = append(api.checks, namedCheck{name: name, check: check})
+}
+
+// healthzHandler reports that the process is alive
+// GET /healthz
+func (api *APIServer) healthzHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	}
+}
+
+// readyzHandler runs readiness checks and returns the result per dependency,
+// 503 status is returned if any of them fails
+// GET /readyz
+func (api *APIServer) readyzHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status, code := "ok", http.StatusOK
+		checks := map[string]checkResult{}
+
+		for _, c := range api.checks {
+			ctx, cancel := context.WithTimeout(r.Context(), readyCheckTimeout)
+			err := c.check(ctx)
+			cancel()
+
+			if err != nil {
+				checks[c.name] = checkResult{Status: "fail", Error: err.Error()}
+				status, code = "fail", http.StatusServiceUnavailable
+				continue
+			}
+			checks[c.name] = checkResult{Status: "ok"}
+		}
+
+		writeJSON(w, code, struct {
+			Status string                 `json:"status"`
+			Checks map[string]checkResult `json:"checks"`
+		}{
+			Status: status,
+			Checks: checks,
+		})
+	}
+}
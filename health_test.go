@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Probes(t *testing.T) {
+	api, err := NewAPIServer(&stubStorer{}, APIConfig{})
+	assert.NoError(t, err)
+
+	rmqErr := error(nil)
+	api.AddReadyCheck("postgres", func(context.Context) error { return nil })
+	api.AddReadyCheck("rabbitmq", func(context.Context) error { return rmqErr })
+
+	ts := httptest.NewServer(api.router(context.Background()))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/healthz")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	readyz := func() (int, map[string]checkResult) {
+		resp, err := http.Get(ts.URL + "/readyz")
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+
+		body := struct {
+			Status string                 `json:"status"`
+			Checks map[string]checkResult `json:"checks"`
+		}{}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		return resp.StatusCode, body.Checks
+	}
+
+	code, checks := readyz()
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]checkResult{"postgres": {Status: "ok"}, "rabbitmq": {Status: "ok"}}, checks)
+
+	rmqErr = errors.New("connection is closed")
+	code, checks = readyz()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, checkResult{Status: "ok"}, checks["postgres"])
+	assert.Equal(t, checkResult{Status: "fail", Error: "connection is closed"}, checks["rabbitmq"])
+}
+
+func Test_CheckFeedsFresh(t *testing.T) {
+	s := &Service{cfg: &Config{StaleFactor: 3}, polls: map[string]feedPoll{}}
+	assert.NoError(t, s.checkFeedsFresh(context.Background()))
+
+	s.polls["http://example.com/fast"] = feedPoll{ttl: 10 * time.Minute, polled: time.Now().Add(-29 * time.Minute)}
+	s.polls["http://example.com/slow"] = feedPoll{ttl: time.Hour, polled: time.Now().Add(-time.Hour)}
+	assert.NoError(t, s.checkFeedsFresh(context.Background()))
+
+	// every feed is checked against its own TTL, the stale one is reported
+	s.polls["http://example.com/fast"] = feedPoll{ttl: 10 * time.Minute, polled: time.Now().Add(-31 * time.Minute)}
+	err := s.checkFeedsFresh(context.Background())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "1 of 2 feeds stale: http://example.com/fast not polled for 31m0s")
+	assert.NotContains(t, err.Error(), "http://example.com/slow")
+
+	s.markPolled(Feed{URL: "http://example.com/fast"}, 10*time.Minute)
+	assert.NoError(t, s.checkFeedsFresh(context.Background()))
+}
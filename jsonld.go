@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// jsonLDArticleTypes are schema.org types of article objects
+var jsonLDArticleTypes = map[string]bool{
+	"Article":                  true,
+	"NewsArticle":              true,
+	"ReportageNewsArticle":     true,
+	"AnalysisNewsArticle":      true,
+	"BackgroundNewsArticle":    true,
+	"OpinionNewsArticle":       true,
+	"LiveBlogPosting":          true,
+	"BlogPosting":              true,
+	"Report":                   true,
+	"ScholarlyArticle":         true,
+	"TechArticle":              true,
+	"SatiricalArticle":         true,
+	"AdvertiserContentArticle": true,
+}
+
+// extractJSONLD finds the first schema.org article object in application/ld+json scripts
+// of the page, objects inside arrays and @graph containers are looked up as well.
+// Returns nil if there is no article object
+func extractJSONLD(doc *goquery.Document) *Article {
+	var found map[string]any
+
+	doc.Find(`script[type="application/ld+json"]`).EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		var data any
+		if err := json.Unmarshal([]byte(s.Text()), &data); err != nil {
+			return true // broken block, try the next one
+		}
+
+		for _, obj := range flattenJSONLD(data) {
+			if isJSONLDArticle(obj) {
+				found = obj
+				return false
+			}
+		}
+		return true
+	})
+
+	if found == nil {
+		return nil
+	}
+
+	article := &Article{
+		Description: ldString(found["description"]),
+		Body:        strings.TrimSpace(ldString(found["articleBody"])),
+		Authors:     uniqueStrings(ldStrings(found["author"])),
+		Publisher:   ldString(found["publisher"]),
+		Published:   parseTime(ldString(found["datePublished"])),
+		Modified:    parseTime(ldString(found["dateModified"])),
+	}
+
+	if images := ldURLs(found["image"]); len(images) > 0 {
+		article.Image = images[0]
+	}
+	if sections := ldStrings(found["articleSection"]); len(sections) > 0 {
+		article.Section = sections[0]
+	}
+
+	// keywords are either a list or a comma-separated string
+	tags := []string{}
+	for _, keywords := range ldStrings(found["keywords"]) {
+		tags = append(tags, strings.Split(keywords, ",")...)
+	}
+	article.Tags = uniqueStrings(tags)
+
+	if urls := append(ldURLs(found["url"]), ldURLs(found["mainEntityOfPage"])...); len(urls) > 0 {
+		article.CanonicalURL = urls[0]
+	}
+
+	return article
+}
+
+// flattenJSONLD returns objects of JSON-LD document, arrays and @graph containers are unwrapped
+func flattenJSONLD(data any) []map[string]any {
+	objects := []map[string]any{}
+
+	switch v := data.(type) {
+	case []any:
+		for _, item := range v {
+			objects = append(objects, flattenJSONLD(item)...)
+		}
+	case map[string]any:
+		objects = append(objects, v)
+		if graph, ok := v["@graph"]; ok {
+			objects = append(objects, flattenJSONLD(graph)...)
+		}
+	}
+
+	return objects
+}
+
+// isJSONLDArticle checks if JSON-LD object @type (single or list) is one of article types
+func isJSONLDArticle(obj map[string]any) bool {
+	for _, t := range ldStrings(obj["@type"]) {
+		if jsonLDArticleTypes[strings.TrimPrefix(t, "schema:")] {
+			return true
+		}
+	}
+	return false
+}
+
+// ldString returns string value of JSON-LD property. Objects (Person, Organization)
+// are represented by name, url or @id, lists by the first value
+func ldString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case map[string]any:
+		for _, key := range []string{"name", "url", "@id"} {
+			if s := ldString(v[key]); s != "" {
+				return s
+			}
+		}
+	case []any:
+		for _, item := range v {
+			if s := ldString(item); s != "" {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// ldStrings returns non-empty string values of JSON-LD property, single value or list
+func ldStrings(v any) []string {
+	values := []string{}
+
+	items, ok := v.([]any)
+	if !ok {
+		items = []any{v}
+	}
+	for _, item := range items {
+		if s := ldString(item); s != "" {
+			values = append(values, s)
+		}
+	}
+
+	return values
+}
+
+// ldURLs returns URLs of JSON-LD property, single value or list.
+// Objects (ImageObject, WebPage) are represented by url, contentUrl or @id
+func ldURLs(v any) []string {
+	urls := []string{}
+
+	items, ok := v.([]any)
+	if !ok {
+		items = []any{v}
+	}
+	for _, item := range items {
+		switch item := item.(type) {
+		case string:
+			if s := strings.TrimSpace(item); s != "" {
+				urls = append(urls, s)
+			}
+		case map[string]any:
+			for _, key := range []string{"url", "contentUrl", "@id"} {
+				if s := ldString(item[key]); s != "" {
+					urls = append(urls, s)
+					break
+				}
+			}
+		}
+	}
+
+	return urls
+}
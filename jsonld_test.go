@@ -0,0 +1,139 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ExtractJSONLD(t *testing.T) {
+
+	cases := []struct {
+		name    string
+		scripts []string
+		exp     *Article
+	}{
+		{"none", nil, nil},
+		{"broken", []string{`{"@type": "NewsArticle", `}, nil},
+		{"not an article", []string{`{"@type": "WebSite", "name": "BBC News"}`}, nil},
+		{"news article", []string{`{
+			"@context": "https://schema.org",
+			"@type": "NewsArticle",
+			"headline": "Headline",
+			"description": "JSON-LD description",
+			"articleBody": "Article body",
+			"datePublished": "2024-07-01T10:00:00.000Z",
+			"dateModified": "2024-07-01T12:30:00+01:00",
+			"author": {"@type": "Person", "name": "John Doe"},
+			"publisher": {"@type": "NewsMediaOrganization", "name": "BBC News", "logo": {"url": "logo.png"}},
+			"image": {"@type": "ImageObject", "name": "Image name", "url": "http://example.com/image.jpg"},
+			"articleSection": "World",
+			"keywords": "Politics, Europe",
+			"mainEntityOfPage": {"@type": "WebPage", "@id": "http://example.com/canonical"}
+		}`}, &Article{
+			Description:  "JSON-LD description",
+			Body:         "Article body",
+			Published:    time.Date(2024, 7, 1, 10, 0, 0, 0, time.UTC),
+			Modified:     time.Date(2024, 7, 1, 11, 30, 0, 0, time.UTC),
+			Authors:      []string{"John Doe"},
+			Publisher:    "BBC News",
+			Image:        "http://example.com/image.jpg",
+			Section:      "World",
+			Tags:         []string{"Politics", "Europe"},
+			CanonicalURL: "http://example.com/canonical",
+		}},
+		{"graph and arrays", []string{
+			`{"@type": "WebSite", "name": "skipped"}`,
+			`{
+				"@context": "https://schema.org",
+				"@graph": [
+					{"@type": "Organization", "name": "Reuters"},
+					{
+						"@type": ["ReportageNewsArticle", "NewsArticle"],
+						"url": "http://example.com/url",
+						"datePublished": "2024-07-01",
+						"author": [{"@type": "Person", "name": "John Doe"}, {"@type": "Person", "name": "Jane Roe"}, "John Doe"],
+						"publisher": [{"@type": "Organization", "name": "Reuters"}],
+						"image": ["http://example.com/1.jpg", {"url": "http://example.com/2.jpg"}],
+						"articleSection": ["World", "Europe"],
+						"keywords": ["Politics", "Europe"]
+					}
+				]
+			}`,
+		}, &Article{
+			Published:    time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC),
+			Authors:      []string{"John Doe", "Jane Roe"},
+			Publisher:    "Reuters",
+			Image:        "http://example.com/1.jpg",
+			Section:      "World",
+			Tags:         []string{"Politics", "Europe"},
+			CanonicalURL: "http://example.com/url",
+		}},
+		{"top level array", []string{`[{"@type": "BreadcrumbList"}, {"@type": "schema:Article", "description": "description"}]`},
+			&Article{Description: "description", Authors: []string{}, Tags: []string{}}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			page := "<html><head>"
+			for _, script := range tc.scripts {
+				page += `<script type="application/ld+json">` + script + `</script>`
+			}
+			page += "</head><body></body></html>"
+
+			doc, err := goquery.NewDocumentFromReader(strings.NewReader(page))
+			assert.NoError(t, err)
+
+			article := extractJSONLD(doc)
+			if tc.exp == nil {
+				assert.Nil(t, article)
+				return
+			}
+			assert.NotNil(t, article)
+
+			assert.Equal(t, tc.exp.Description, article.Description)
+			assert.Equal(t, tc.exp.Body, article.Body)
+			assert.True(t, tc.exp.Published.Equal(article.Published))
+			assert.True(t, tc.exp.Modified.Equal(article.Modified))
+			assert.ElementsMatch(t, tc.exp.Authors, article.Authors)
+			assert.Equal(t, tc.exp.Publisher, article.Publisher)
+			assert.Equal(t, tc.exp.Image, article.Image)
+			assert.Equal(t, tc.exp.Section, article.Section)
+			assert.ElementsMatch(t, tc.exp.Tags, article.Tags)
+			assert.Equal(t, tc.exp.CanonicalURL, article.CanonicalURL)
+		})
+	}
+}
+
+// JSON-LD fields are preferred over meta tags, missing ones are taken from meta tags
+func Test_ExtractArticleJSONLD(t *testing.T) {
+	page := `<html><head>
+	<meta name="description" content="meta description">
+	<meta property="og:image" content="http://example.com/meta.jpg">
+	<meta property="og:site_name" content="Site name">
+	<meta property="article:section" content="Meta section">
+	<meta name="author" content="Meta Author">
+	<script type="application/ld+json">{
+		"@type": "NewsArticle",
+		"description": "JSON-LD description",
+		"image": "http://example.com/jsonld.jpg",
+		"author": {"name": "JSON-LD Author"},
+		"datePublished": "2024-07-01T10:00:00Z"
+	}</script>
+	</head><body></body></html>`
+
+	article, err := extractArticle(page, metaExtractor{})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "JSON-LD description", article.Description)
+	assert.Equal(t, "http://example.com/jsonld.jpg", article.Image)
+	assert.Equal(t, []string{"JSON-LD Author"}, article.Authors)
+	assert.True(t, time.Date(2024, 7, 1, 10, 0, 0, 0, time.UTC).Equal(article.Published))
+
+	assert.Equal(t, "Meta section", article.Section)
+	assert.Equal(t, "Site name", article.Publisher)
+	assert.Equal(t, "http://example.com/meta.jpg", article.Meta["og:image"]) // meta properties are kept
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// hostLimiters keeps token bucket rate limiter per host.
+// nil *hostLimiters doesn't limit anything
+type hostLimiters struct {
+	limit rate.Limit
+	burst int
+
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+}
+
+// newHostLimiters creates limiters allowing rps requests per second with given burst
+// to every host, returns nil (no limits) if rps is not positive
+func newHostLimiters(rps float64, burst int) *hostLimiters {
+	if rps <= 0 {
+		return nil
+	}
+
+	return &hostLimiters{
+		limit:    rate.Limit(rps),
+		burst:    max(burst, 1),
+		limiters: make(map[string]*rate.Limiter),
+	}
+}
+
+// Wait blocks until request to the host of given URL is allowed or context is done
+func (l *hostLimiters) Wait(ctx context.Context, rawURL string) error {
+	if l == nil {
+		return nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		// nothing to limit, request will fail on its own
+		return nil
+	}
+
+	return l.get(u.Hostname()).Wait(ctx)
+}
+
+// get returns limiter of the host, creating it on first use
+func (l *hostLimiters) get(host string) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	limiter, ok := l.limiters[host]
+	if !ok {
+		limiter = rate.NewLimiter(l.limit, l.burst)
+		l.limiters[host] = limiter
+	}
+
+	return limiter
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_HostLimiters(t *testing.T) {
+	ctx := context.Background()
+
+	// nil limiters don't limit
+	var unlimited *hostLimiters
+	assert.Nil(t, newHostLimiters(0, 10))
+	assert.NoError(t, unlimited.Wait(ctx, "https://www.bbc.co.uk/news/1"))
+
+	// 10 rps, burst of 2
+	l := newHostLimiters(10, 2)
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, l.Wait(ctx, "https://www.bbc.co.uk/news/1"))
+	}
+	// burst passes immediately, 2 more requests wait 100ms each
+	assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+
+	// other host has its own bucket
+	start = time.Now()
+	assert.NoError(t, l.Wait(ctx, "https://www.reuters.com/world/1"))
+	assert.NoError(t, l.Wait(ctx, "https://www.reuters.com/world/2"))
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+
+	// same host, different port and path share the bucket
+	assert.Len(t, l.limiters, 2)
+	assert.NoError(t, l.Wait(ctx, "https://www.reuters.com:443/world/3"))
+	assert.Len(t, l.limiters, 2)
+
+	// invalid URLs are not limited
+	assert.NoError(t, l.Wait(ctx, "error"))
+
+	// context cancellation stops waiting
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.Error(t, l.Wait(ctx, "https://www.bbc.co.uk/news/1"))
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// memQueue is an in-process Queue for single binary mode, backed by buffered channels,
+// one per message priority. Messages are not persisted, the ones not processed are lost on exit
+type memQueue struct {
+	msgs  [maxPriority + 1]chan EnrichDelivery
+	retry retryPolicy
+
+	mu     sync.Mutex
+	closed bool
+	timers map[*time.Timer]struct{} // pending retries
+}
+
+// newMemQueue creates in-process queue holding up to size messages of every priority
+func newMemQueue(size int, retry retryPolicy) *memQueue {
+	q := &memQueue{
+		retry:  retry,
+		timers: map[*time.Timer]struct{}{},
+	}
+	for i := range q.msgs {
+		q.msgs[i] = make(chan EnrichDelivery, max(size, 1))
+	}
+	return q
+}
+
+// Send implements Queue, error is returned if the queue is full
+func (q *memQueue) Send(payload []byte) error {
+	msg, err := DecodeEnrichMessage(payload)
+	if err != nil {
+		queuePublishErrors.Inc()
+		return fmt.Errorf("failed to decode a message: %w", err)
+	}
+
+	err = q.put(EnrichDelivery{Msg: msg})
+	if err != nil {
+		queuePublishErrors.Inc()
+		return err
+	}
+	queuePublished.Inc()
+
+	return nil
+}
+
+// put adds delivery to the queue without blocking
+func (q *memQueue) put(d EnrichDelivery) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return fmt.Errorf("queue is closed")
+	}
+
+	msgs := q.msgs[d.Msg.Priority]
+	select {
+	case msgs <- d:
+		return nil
+	default:
+		return fmt.Errorf("queue of %d messages is full", cap(msgs))
+	}
+}
+
+// Receive implements Queue, re-enrichment messages are delivered first.
+// Messages are validated on Send, so there is nothing to park
+func (q *memQueue) Receive(ctx context.Context) (<-chan EnrichDelivery, error) {
+	out := make(chan EnrichDelivery)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case d := <-q.msgs[PriorityReenrich]:
+				out <- d
+				continue
+			default:
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case d := <-q.msgs[PriorityReenrich]:
+				out <- d
+			case d := <-q.msgs[PriorityNormal]:
+				out <- d
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// Ack implements Queue, processed message is just forgotten
+func (q *memQueue) Ack(_ EnrichDelivery) error {
+	return nil
+}
+
+// Retry implements Queue, message is put back to the queue after the backoff delay
+func (q *memQueue) Retry(d EnrichDelivery) error {
+	attempt := d.Msg.Attempt + 1
+	if attempt > q.retry.maxRetries {
+		log.Printf("[WARN] message retries exhausted (%d), dead-lettering", q.retry.maxRetries)
+		return q.DeadLetter(d)
+	}
+	d.Msg.Attempt = attempt
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return fmt.Errorf("queue is closed")
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(q.retry.backoff(attempt), func() {
+		q.mu.Lock()
+		delete(q.timers, timer)
+		q.mu.Unlock()
+
+		if err := q.put(d); err != nil {
+			log.Printf("[ERROR] failed to retry a message, correlation %s: %v", d.Msg.CorrelationID, err)
+		}
+	})
+	q.timers[timer] = struct{}{}
+	log.Printf("[DEBUG] message scheduled for retry %d/%d in %s", attempt, q.retry.maxRetries, q.retry.backoff(attempt))
+
+	return nil
+}
+
+// DeadLetter implements Queue, there is no dead letter storage in memory, the message is logged and dropped
+func (q *memQueue) DeadLetter(d EnrichDelivery) error {
+	log.Printf("[WARN] message dead-lettered: id=%d %s, correlation %s", d.Msg.NewsID, d.Msg.Link, d.Msg.CorrelationID)
+	return nil
+}
+
+// Ping implements Queue, in-process queue is always available
+func (q *memQueue) Ping(_ context.Context) error {
+	return nil
+}
+
+// Close implements Queue, pending retries are cancelled
+func (q *memQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.closed = true
+	for timer := range q.timers {
+		timer.Stop()
+	}
+	n := len(q.timers)
+	for _, msgs := range q.msgs {
+		n += len(msgs)
+	}
+	if n > 0 {
+		log.Printf("[WARN] %d queued messages are dropped", n)
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// receiveDelivery waits for the next delivery from the channel
+func receiveDelivery(t *testing.T, ch <-chan EnrichDelivery) EnrichDelivery {
+	select {
+	case d := <-ch:
+		return d
+	case <-time.After(5 * time.Second):
+		t.Fatal("message not received")
+	}
+	return EnrichDelivery{}
+}
+
+func Test_MemQueue(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q := newMemQueue(2, retryPolicy{maxRetries: 1, delay: 10 * time.Millisecond})
+	defer q.Close()
+
+	msgs, err := q.Receive(ctx)
+	assert.NoError(t, err)
+
+	// invalid message is not accepted
+	assert.Error(t, q.Send([]byte(`{"version":2,"news_id":1}`)))
+
+	sent := NewEnrichMessage(&NewsItem{ID: 1, Link: "https://example.com/news"})
+	payload, err := sent.Encode()
+	assert.NoError(t, err)
+	assert.NoError(t, q.Send(payload))
+
+	d := receiveDelivery(t, msgs)
+	assert.Equal(t, sent, d.Msg)
+
+	// retried message comes back after the backoff with the attempt
+	retried := time.Now()
+	assert.NoError(t, q.Retry(d))
+	d = receiveDelivery(t, msgs)
+	assert.Equal(t, 1, d.Msg.Attempt)
+	assert.GreaterOrEqual(t, time.Since(retried), 10*time.Millisecond)
+
+	// retries exhausted, dropped
+	assert.NoError(t, q.Retry(d))
+	select {
+	case d := <-msgs:
+		t.Fatalf("unexpected message: %+v", d.Msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// receiving is stopped, the queue is bounded
+	cancel()
+	for range msgs {
+	}
+	assert.NoError(t, q.Send(payload))
+	assert.NoError(t, q.Send(payload))
+	assert.Error(t, q.Send(payload))
+}
+
+func Test_MemQueuePriority(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q := newMemQueue(2, retryPolicy{maxRetries: 1, delay: 10 * time.Millisecond})
+	defer q.Close()
+
+	for id := 1; id <= 3; id++ {
+		msg := NewEnrichMessage(&NewsItem{ID: id, Link: "https://example.com/news"})
+		if id == 3 {
+			msg.Priority = PriorityReenrich
+		}
+		payload, err := msg.Encode()
+		assert.NoError(t, err)
+		assert.NoError(t, q.Send(payload))
+	}
+
+	msgs, err := q.Receive(ctx)
+	assert.NoError(t, err)
+
+	// re-enrichment goes first, the rest in order
+	for _, id := range []int{3, 1, 2} {
+		assert.Equal(t, id, receiveDelivery(t, msgs).Msg.NewsID)
+	}
+}
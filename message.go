@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go/jetstream"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// messageVersion is the current version of the enrichment message schema
+const messageVersion = 1
+
+// EnrichArticle requests fetching the article page and extracting article data
+const EnrichArticle = "article"
+
+// Message priorities, messages of higher priority are delivered first
+const (
+	PriorityNormal   = 0 // new news items
+	PriorityReenrich = 1 // re-enrichment of stale and incomplete items, not to wait behind new ones
+	maxPriority      = PriorityReenrich
+)
+
+// knownEnrichments are enrichments the consumer is able to apply
+var knownEnrichments = map[string]bool{
+	EnrichArticle: true,
+}
+
+var (
+	// ErrUnknownVersion is returned for messages of unsupported schema version
+	ErrUnknownVersion = errors.New("unknown message version")
+	// ErrInvalidMessage is returned for malformed messages
+	ErrInvalidMessage = errors.New("invalid message")
+)
+
+// EnrichMessage is a request to enrich news item, sent through the queue as JSON
+type EnrichMessage struct {
+	Version       int      `json:"version"`
+	NewsID        int      `json:"news_id"`
+	Link          string   `json:"link"`
+	FeedID        int      `json:"feed_id,omitempty"`
+	Attempt       int      `json:"attempt"`               // number of retries made, 0 for the first delivery
+	Priority      int      `json:"priority,omitempty"`    // PriorityNormal or higher
+	Enrichments   []string `json:"enrichments,omitempty"` // requested enrichments, empty for all of them
+	CorrelationID string   `json:"correlation_id"`        // traces the item through logs of all stages
+}
+
+// NewEnrichMessage creates message requesting enrichments of the news item, all of them if none given
+func NewEnrichMessage(item *NewsItem, enrichments ...string) EnrichMessage {
+	return EnrichMessage{
+		Version:       messageVersion,
+		NewsID:        item.ID,
+		Link:          item.Link,
+		FeedID:        item.FeedID,
+		Enrichments:   enrichments,
+		CorrelationID: uuid.NewString(),
+	}
+}
+
+// Validate checks message schema version and required fields
+func (m EnrichMessage) Validate() error {
+	if m.Version != messageVersion {
+		return fmt.Errorf("%w %d", ErrUnknownVersion, m.Version)
+	}
+	if m.NewsID <= 0 {
+		return fmt.Errorf("%w: news_id is required", ErrInvalidMessage)
+	}
+	if m.Priority < PriorityNormal || m.Priority > maxPriority {
+		return fmt.Errorf("%w: unknown priority %d", ErrInvalidMessage, m.Priority)
+	}
+	for _, e := range m.Enrichments {
+		if !knownEnrichments[e] {
+			return fmt.Errorf("%w: unknown enrichment %q", ErrInvalidMessage, e)
+		}
+	}
+	return nil
+}
+
+// Wants checks if the enrichment is requested by the message
+func (m EnrichMessage) Wants(enrichment string) bool {
+	if len(m.Enrichments) == 0 {
+		return true
+	}
+	for _, e := range m.Enrichments {
+		if e == enrichment {
+			return true
+		}
+	}
+	return false
+}
+
+// Encode validates and marshals message to JSON
+func (m EnrichMessage) Encode() ([]byte, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(m)
+}
+
+// DecodeEnrichMessage unmarshals and validates message
+func DecodeEnrichMessage(data []byte) (EnrichMessage, error) {
+	m := EnrichMessage{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+	}
+	return m, m.Validate()
+}
+
+// messagePriority returns priority of encoded message, PriorityNormal if it can't be decoded,
+// such messages are parked by the consumer
+func messagePriority(data []byte) int {
+	m, err := DecodeEnrichMessage(data)
+	if err != nil {
+		return PriorityNormal
+	}
+	return m.Priority
+}
+
+// EnrichDelivery is a decoded enrichment message with the delivery to acknowledge
+type EnrichDelivery struct {
+	Msg      EnrichMessage
+	Delivery amqp.Delivery // RabbitMQ delivery, set by AMQP queue
+	jobID    int64         // queue_jobs row, set by Postgres queue
+	natsMsg  jetstream.Msg // JetStream message, set by NATS queue
+}
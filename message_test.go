@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_EnrichMessage(t *testing.T) {
+	item := &NewsItem{ID: 42, Link: "https://example.com/news", FeedID: 3}
+
+	msg := NewEnrichMessage(item)
+	assert.Equal(t, messageVersion, msg.Version)
+	assert.NotEmpty(t, msg.CorrelationID)
+	assert.True(t, msg.Wants(EnrichArticle))
+
+	data, err := msg.Encode()
+	assert.NoError(t, err)
+
+	decoded, err := DecodeEnrichMessage(data)
+	assert.NoError(t, err)
+	assert.Equal(t, msg, decoded)
+
+	// requested enrichments only
+	msg = NewEnrichMessage(item, EnrichArticle)
+	assert.True(t, msg.Wants(EnrichArticle))
+	assert.False(t, msg.Wants("translation"))
+
+	assert.Equal(t, PriorityNormal, messagePriority(data))
+	msg.Priority = PriorityReenrich
+	data, err = msg.Encode()
+	assert.NoError(t, err)
+	assert.Equal(t, PriorityReenrich, messagePriority(data))
+	assert.Equal(t, PriorityNormal, messagePriority([]byte("https://example.com")))
+}
+
+func Test_DecodeEnrichMessage(t *testing.T) {
+	cases := []struct {
+		name string
+		data string
+		err  error
+	}{
+		{"valid", `{"version":1,"news_id":1,"link":"https://example.com"}`, nil},
+		{"bare link", `https://example.com`, ErrInvalidMessage},
+		{"unknown version", `{"version":2,"news_id":1}`, ErrUnknownVersion},
+		{"no version", `{"news_id":1}`, ErrUnknownVersion},
+		{"no news id", `{"version":1,"link":"https://example.com"}`, ErrInvalidMessage},
+		{"unknown enrichment", `{"version":1,"news_id":1,"enrichments":["translation"]}`, ErrInvalidMessage},
+		{"re-enrichment", `{"version":1,"news_id":1,"priority":1}`, nil},
+		{"unknown priority", `{"version":1,"news_id":1,"priority":5}`, ErrInvalidMessage},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := DecodeEnrichMessage([]byte(tc.data))
+			if tc.err == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tc.err)
+		})
+	}
+}
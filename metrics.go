@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// metricsNamespace prefixes names of all service metrics
+const metricsNamespace = "bbcrss"
+
+// Prometheus metrics, registered in the default registry and exposed on /metrics
+var (
+	feedFetchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "feed_fetch_duration_seconds",
+		Help:      "Duration of feed fetch requests.",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"feed"})
+
+	feedFetches = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "feed_fetches_total",
+		Help:      "Number of feed fetches by response status, \"error\" if there is no response.",
+	}, []string{"feed", "status"})
+
+	feedItems = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "feed_items_total",
+		Help:      "Number of feed items by processing result: parsed, saved, revised (title or publication time changed), skipped (duplicate) or failed.",
+	}, []string{"feed", "result"})
+
+	enrichments = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "enrichments_total",
+		Help:      "Number of news enrichments by result: success or failure.",
+	}, []string{"result"})
+
+	enrichmentDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "enrichment_duration_seconds",
+		Help:      "Duration of news item enrichment, including article fetch.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	})
+
+	queuePublished = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "queue_published_total",
+		Help:      "Number of messages published to the queue.",
+	})
+
+	queuePublishErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "queue_publish_errors_total",
+		Help:      "Number of failed publishes to the queue.",
+	})
+
+	dbQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Duration of database queries by storage method.",
+		Buckets:   []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1},
+	}, []string{"query"})
+
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests by route and status.",
+	}, []string{"method", "route", "status"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Duration of HTTP requests by route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+)
+
+// observeFeedFetch records duration and status of the feed fetch
+func observeFeedFetch(feed string, started time.Time, err error) {
+	feedFetchDuration.WithLabelValues(feed).Observe(time.Since(started).Seconds())
+
+	status := strconv.Itoa(http.StatusOK)
+	var statusErr *StatusError
+	switch {
+	case errors.Is(err, ErrNotModified):
+		status = strconv.Itoa(http.StatusNotModified)
+	case errors.As(err, &statusErr):
+		status = strconv.Itoa(statusErr.Code)
+	case err != nil:
+		status = "error"
+	}
+	feedFetches.WithLabelValues(feed, status).Inc()
+}
+
+// observeQuery starts timing of the storage query, returned function records the duration.
+// Usage: defer observeQuery("get_news")()
+func observeQuery(query string) func() {
+	started := time.Now()
+	return func() {
+		dbQueryDuration.WithLabelValues(query).Observe(time.Since(started).Seconds())
+	}
+}
+
+// metricsMiddleware records HTTP requests count and duration by chi route pattern,
+// so requests to /news/1 and /news/2 are counted together
+func metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		route := "unknown"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		httpRequests.WithLabelValues(r.Method, route, strconv.Itoa(status)).Inc()
+		httpRequestDuration.WithLabelValues(r.Method, route).Observe(time.Since(started).Seconds())
+	})
+}
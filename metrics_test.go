@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ObserveFeedFetch(t *testing.T) {
+	feed := "https://example.com/metrics.xml"
+
+	observeFeedFetch(feed, time.Now(), nil)
+	observeFeedFetch(feed, time.Now(), ErrNotModified)
+	observeFeedFetch(feed, time.Now(), &StatusError{Code: http.StatusBadGateway})
+	observeFeedFetch(feed, time.Now(), errors.New("connection refused"))
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(feedFetches.WithLabelValues(feed, "200")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(feedFetches.WithLabelValues(feed, "304")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(feedFetches.WithLabelValues(feed, "502")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(feedFetches.WithLabelValues(feed, "error")))
+}
+
+func Test_MetricsEndpoint(t *testing.T) {
+	api, err := NewAPIServer(&stubStorer{}, APIConfig{})
+	assert.NoError(t, err)
+
+	ts := httptest.NewServer(api.router(context.Background()))
+	defer ts.Close()
+
+	// the series is shared with other tests of the package
+	notFound := httpRequests.WithLabelValues("GET", "/api/v1/news/{id}", "404")
+	before := testutil.ToFloat64(notFound)
+
+	for _, path := range []string{"/api/v1/news/1", "/api/v1/news/2"} {
+		resp, err := http.Get(ts.URL + path)
+		assert.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	}
+
+	// requests are counted by route pattern, not by path
+	assert.Equal(t, 2.0, testutil.ToFloat64(notFound)-before)
+
+	resp, err := http.Get(ts.URL + "/metrics")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
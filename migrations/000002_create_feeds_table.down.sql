@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS news_feed_id_idx;
+ALTER TABLE news DROP COLUMN IF EXISTS feed_id;
+DROP TABLE IF EXISTS feeds;
\ No newline at end of file
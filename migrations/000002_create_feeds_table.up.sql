@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS feeds (
+	id SERIAL PRIMARY KEY,
+	url text NOT NULL UNIQUE,
+	title text NOT NULL DEFAULT '',
+	ttl interval NOT NULL DEFAULT '15 minutes',
+	enabled boolean NOT NULL DEFAULT true
+);
+
+ALTER TABLE news ADD COLUMN IF NOT EXISTS feed_id integer REFERENCES feeds(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS news_feed_id_idx ON news (feed_id);
\ No newline at end of file
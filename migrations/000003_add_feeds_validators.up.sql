@@ -0,0 +1,2 @@
+ALTER TABLE feeds ADD COLUMN IF NOT EXISTS etag text NOT NULL DEFAULT '';
+ALTER TABLE feeds ADD COLUMN IF NOT EXISTS last_modified text NOT NULL DEFAULT '';
\ No newline at end of file
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS news_search_idx;
+ALTER TABLE news DROP COLUMN IF EXISTS search;
\ No newline at end of file
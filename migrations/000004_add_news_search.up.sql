@@ -0,0 +1,4 @@
+ALTER TABLE news ADD COLUMN IF NOT EXISTS search tsvector GENERATED ALWAYS AS (
+	setweight(to_tsvector('english', title), 'A') || setweight(to_tsvector('english', description), 'B')
+) STORED;
+CREATE INDEX IF NOT EXISTS news_search_idx ON news USING GIN (search);
\ No newline at end of file
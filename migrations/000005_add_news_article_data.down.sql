@@ -0,0 +1,9 @@
+ALTER TABLE news
+	DROP COLUMN IF EXISTS meta,
+	DROP COLUMN IF EXISTS article_modified,
+	DROP COLUMN IF EXISTS article_published,
+	DROP COLUMN IF EXISTS canonical_url,
+	DROP COLUMN IF EXISTS tags,
+	DROP COLUMN IF EXISTS section,
+	DROP COLUMN IF EXISTS authors,
+	DROP COLUMN IF EXISTS body;
\ No newline at end of file
@@ -0,0 +1,9 @@
+ALTER TABLE news
+	ADD COLUMN IF NOT EXISTS body text NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS authors text[] NOT NULL DEFAULT '{}',
+	ADD COLUMN IF NOT EXISTS section text NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS tags text[] NOT NULL DEFAULT '{}',
+	ADD COLUMN IF NOT EXISTS canonical_url text NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS article_published timestamp with time zone,
+	ADD COLUMN IF NOT EXISTS article_modified timestamp with time zone,
+	ADD COLUMN IF NOT EXISTS meta jsonb NOT NULL DEFAULT '{}';
\ No newline at end of file
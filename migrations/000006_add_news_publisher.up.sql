@@ -0,0 +1 @@
+ALTER TABLE news ADD COLUMN IF NOT EXISTS publisher text NOT NULL DEFAULT '';
\ No newline at end of file
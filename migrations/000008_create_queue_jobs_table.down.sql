@@ -0,0 +1 @@
+DROP TABLE IF EXISTS queue_jobs;
\ No newline at end of file
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS queue_jobs (
+	id BIGSERIAL PRIMARY KEY,
+	payload text NOT NULL,
+	status text NOT NULL DEFAULT 'pending', -- pending, processing, dead or parked
+	attempt integer NOT NULL DEFAULT 0,
+	available_at timestamptz NOT NULL DEFAULT now(),
+	locked_until timestamptz,
+	last_error text NOT NULL DEFAULT '',
+	created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS queue_jobs_available_idx ON queue_jobs (id) WHERE status IN ('pending', 'processing');
\ No newline at end of file
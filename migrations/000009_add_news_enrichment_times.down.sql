@@ -0,0 +1,3 @@
+ALTER TABLE news
+	DROP COLUMN IF EXISTS enrich_requested_at,
+	DROP COLUMN IF EXISTS enriched_at;
\ No newline at end of file
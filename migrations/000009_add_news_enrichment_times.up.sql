@@ -0,0 +1,3 @@
+ALTER TABLE news
+	ADD COLUMN IF NOT EXISTS enriched_at timestamp with time zone,
+	ADD COLUMN IF NOT EXISTS enrich_requested_at timestamp with time zone NOT NULL DEFAULT now();
\ No newline at end of file
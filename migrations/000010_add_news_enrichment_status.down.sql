@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS news_enrichment_status_idx;
+
+ALTER TABLE news
+	DROP COLUMN IF EXISTS last_error,
+	DROP COLUMN IF EXISTS enrichment_attempts,
+	DROP COLUMN IF EXISTS enrichment_status;
\ No newline at end of file
@@ -0,0 +1,8 @@
+ALTER TABLE news
+	ADD COLUMN IF NOT EXISTS enrichment_status text NOT NULL DEFAULT 'pending',
+	ADD COLUMN IF NOT EXISTS enrichment_attempts integer NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS last_error text NOT NULL DEFAULT '';
+
+UPDATE news SET enrichment_status = 'success' WHERE enriched_at IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS news_enrichment_status_idx ON news (enrichment_status) WHERE enrichment_status <> 'success';
\ No newline at end of file
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS news_revisions (
+	id BIGSERIAL PRIMARY KEY,
+	news_id integer NOT NULL REFERENCES news(id) ON DELETE CASCADE,
+	title text NOT NULL,
+	published timestamp with time zone NOT NULL,
+	changed_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS news_revisions_news_id_idx ON news_revisions (news_id, changed_at);
\ No newline at end of file
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS news_published_id_idx;
\ No newline at end of file
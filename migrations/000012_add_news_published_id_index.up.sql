@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS news_published_id_idx ON news (published DESC, id DESC);
\ No newline at end of file
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS news_story_cluster_id_idx;
+
+ALTER TABLE news
+	DROP COLUMN IF EXISTS story_cluster_id,
+	DROP COLUMN IF EXISTS fingerprint;
\ No newline at end of file
@@ -0,0 +1,7 @@
+ALTER TABLE news
+	ADD COLUMN IF NOT EXISTS fingerprint bigint,
+	ADD COLUMN IF NOT EXISTS story_cluster_id integer;
+
+UPDATE news SET story_cluster_id = id WHERE story_cluster_id IS NULL;
+
+CREATE INDEX IF NOT EXISTS news_story_cluster_id_idx ON news (story_cluster_id);
\ No newline at end of file
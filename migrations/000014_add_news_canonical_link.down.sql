@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS news_article_link_idx;
+DROP INDEX IF EXISTS news_canonical_link_idx;
+
+ALTER TABLE news
+	DROP COLUMN IF EXISTS article_link,
+	DROP COLUMN IF EXISTS canonical_link;
\ No newline at end of file
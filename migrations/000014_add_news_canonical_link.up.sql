@@ -0,0 +1,6 @@
+ALTER TABLE news
+	ADD COLUMN IF NOT EXISTS canonical_link text,
+	ADD COLUMN IF NOT EXISTS article_link text;
+
+CREATE UNIQUE INDEX IF NOT EXISTS news_canonical_link_idx ON news (canonical_link);
+CREATE INDEX IF NOT EXISTS news_article_link_idx ON news (article_link);
\ No newline at end of file
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS queue_jobs_available_idx;
+
+CREATE INDEX IF NOT EXISTS queue_jobs_available_idx ON queue_jobs (id) WHERE status IN ('pending', 'processing');
+
+ALTER TABLE queue_jobs
+	DROP COLUMN IF EXISTS priority;
\ No newline at end of file
@@ -0,0 +1,6 @@
+ALTER TABLE queue_jobs
+	ADD COLUMN IF NOT EXISTS priority smallint NOT NULL DEFAULT 0;
+
+DROP INDEX IF EXISTS queue_jobs_available_idx;
+
+CREATE INDEX IF NOT EXISTS queue_jobs_available_idx ON queue_jobs (priority DESC, id) WHERE status IN ('pending', 'processing');
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE outbox
+	ADD COLUMN IF NOT EXISTS claimed_until timestamptz;
\ No newline at end of file
@@ -0,0 +1,3 @@
+UPDATE outbox SET payload = payload::json->>'link'
+WHERE sent_at IS NULL
+	AND payload LIKE '{%';
\ No newline at end of file
@@ -0,0 +1,14 @@
+-- outbox messages written by earlier versions are bare links, pending ones are converted
+-- to enrichment messages of the news items, the rest would be parked by the consumer
+UPDATE outbox SET payload = json_build_object(
+		'version', 1,
+		'news_id', news.id,
+		'link', news.link,
+		'feed_id', COALESCE(news.feed_id, 0),
+		'attempt', 0,
+		'correlation_id', gen_random_uuid()
+	)::text
+FROM news
+WHERE outbox.sent_at IS NULL
+	AND outbox.payload NOT LIKE '{%'
+	AND news.link = outbox.payload;
\ No newline at end of file
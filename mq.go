@@ -1,48 +1,357 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"sync"
+	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
+const (
+	// retryHeader is the message header carrying number of processing retries
+	retryHeader = "x-retry-count"
+	// parkReasonHeader is the header of parked message, explaining why it is parked
+	parkReasonHeader = "x-park-reason"
+	// consumerTag identifies news consumer on the channel
+	consumerTag = "enrichment"
+)
+
+const (
+	// reconnectMinDelay is the delay before the first reconnection attempt, doubled with every next one
+	reconnectMinDelay = time.Second
+	// reconnectMaxDelay limits the delay between reconnection attempts
+	reconnectMaxDelay = 30 * time.Second
+)
+
+// Mq is a RabbitMQ client, reconnecting automatically when connection is lost.
+// Topology is redeclared and consuming is resumed after reconnection,
+// messages published during the outage are kept in a bounded buffer
 type Mq struct {
-	name string
-	conn *amqp.Connection
-	ch   *amqp.Channel
+	dsn            string
+	name           string
+	maxRetries     int
+	retryDelay     time.Duration
+	prefetch       int
+	publishTimeout time.Duration
+
+	mu     sync.RWMutex
+	conn   *amqp.Connection
+	ch     *amqp.Channel
+	ready  chan struct{} // closed while connected, replaced on disconnect
+	buffer chan []byte   // messages published while disconnected
+	done   chan struct{} // closed on Close, stops reconnection
 }
 
-// NewMq creates new connection to RabbitMQ
+// NewMq creates new connection to RabbitMQ in confirm mode and declares durable queues:
+//   - main priority queue, dead-lettering rejected messages to <name>.dlx exchange
+//   - <name>.retry.N delay queues, returning messages to the main queue after the TTL expires
+//   - <name>.dead queue, collecting dead-lettered messages
+//   - <name>.parking queue, collecting messages of unknown version or schema
 func NewMq(cfg RMQConfig) (*Mq, error) {
-	conn, err := amqp.Dial(cfg.Dsn)
+	retryDelay, err := time.ParseDuration(cfg.RetryDelay)
+	if err != nil {
+		return nil, fmt.Errorf("[ERROR] failed to parse retry delay %w", err)
+	}
+
+	publishTimeout, err := time.ParseDuration(cfg.PublishTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("[ERROR] failed to parse publish timeout %w", err)
+	}
+
+	mq := &Mq{
+		dsn:            cfg.Dsn,
+		name:           cfg.Name,
+		maxRetries:     cfg.MaxRetries,
+		retryDelay:     retryDelay,
+		prefetch:       cfg.Prefetch,
+		publishTimeout: publishTimeout,
+		ready:          make(chan struct{}),
+		buffer:         make(chan []byte, max(cfg.PublishBuffer, 0)),
+		done:           make(chan struct{}),
+	}
+
+	err = mq.connect()
+	if err != nil {
+		return nil, err
+	}
+	close(mq.ready)
+
+	go mq.watch()
+
+	return mq, nil
+}
+
+// connect dials RabbitMQ, opens a channel and declares topology
+func (mq *Mq) connect() error {
+	conn, err := amqp.Dial(mq.dsn)
 	if err != nil {
-		return nil, fmt.Errorf("[ERROR] failed to connect to RabbitMQ %w", err)
+		return fmt.Errorf("[ERROR] failed to connect to RabbitMQ %w", err)
 	}
 
 	ch, err := conn.Channel()
 	if err != nil {
-		return nil, fmt.Errorf("[ERROR] failed to open a channel %w", err)
+		conn.Close()
+		return fmt.Errorf("[ERROR] failed to open a channel %w", err)
+	}
+
+	err = ch.Confirm(false)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("[ERROR] failed to put channel in confirm mode %w", err)
 	}
 
-	// declare a queue for news items with default settings
-	_, err = ch.QueueDeclare(
-		cfg.Name, // name
-		false,    // durable
-		false,    // delete when unused
-		false,    // exclusive
-		false,    // no-wait
-		nil,      // arguments
+	mq.mu.Lock()
+	mq.conn, mq.ch = conn, ch
+	mq.mu.Unlock()
+
+	err = mq.declare()
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	return nil
+}
+
+// watch waits for the connection or channel to close and reconnects, until Mq is closed
+func (mq *Mq) watch() {
+	for {
+		mq.mu.RLock()
+		connClosed := mq.conn.NotifyClose(make(chan *amqp.Error, 1))
+		chClosed := mq.ch.NotifyClose(make(chan *amqp.Error, 1))
+		mq.mu.RUnlock()
+
+		var amqpErr *amqp.Error
+		select {
+		case <-mq.done:
+			return
+		case amqpErr = <-connClosed:
+		case amqpErr = <-chClosed:
+		}
+
+		select {
+		case <-mq.done:
+			return // closed by Close
+		default:
+		}
+
+		log.Printf("[WARN] RabbitMQ connection lost: %v, reconnecting", amqpErr)
+		mq.disconnect()
+		if !mq.reconnect() {
+			return
+		}
+		mq.flush()
+	}
+}
+
+// disconnect marks Mq as disconnected and closes what's left of the connection
+func (mq *Mq) disconnect() {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+
+	mq.ready = make(chan struct{})
+	if !mq.conn.IsClosed() {
+		mq.conn.Close()
+	}
+}
+
+// reconnect tries to connect with exponential backoff, returns false if Mq is closed meanwhile
+func (mq *Mq) reconnect() bool {
+	delay := reconnectMinDelay
+	for {
+		select {
+		case <-mq.done:
+			return false
+		case <-time.After(delay):
+		}
+
+		err := mq.connect()
+		if err == nil {
+			mq.mu.Lock()
+			close(mq.ready)
+			mq.mu.Unlock()
+			log.Printf("[INFO] reconnected to RabbitMQ")
+			return true
+		}
+
+		log.Printf("[WARN] failed to reconnect to RabbitMQ, next attempt in %s: %v", delay, err)
+		delay = min(delay*2, reconnectMaxDelay)
+	}
+}
+
+// readyCh returns channel which is closed while Mq is connected
+func (mq *Mq) readyCh() <-chan struct{} {
+	mq.mu.RLock()
+	defer mq.mu.RUnlock()
+	return mq.ready
+}
+
+// connected checks if Mq is connected at the moment
+func (mq *Mq) connected() bool {
+	select {
+	case <-mq.readyCh():
+		return true
+	default:
+		return false
+	}
+}
+
+// channel returns current channel
+func (mq *Mq) channel() *amqp.Channel {
+	mq.mu.RLock()
+	defer mq.mu.RUnlock()
+	return mq.ch
+}
+
+// flush publishes messages buffered during the outage
+func (mq *Mq) flush() {
+	flushed := 0
+	for {
+		select {
+		case msg := <-mq.buffer:
+			err := mq.publish(msg)
+			if err != nil {
+				// connection is lost again, the rest waits for the next reconnection
+				log.Printf("[WARN] failed to publish buffered message: %v", err)
+				mq.bufferMessage(msg) //nolint:errcheck // dropped if the buffer is full again
+				return
+			}
+			flushed++
+		default:
+			if flushed > 0 {
+				log.Printf("[INFO] %d buffered messages published", flushed)
+			}
+			return
+		}
+	}
+}
+
+// declare declares exchanges and queues used for news items processing
+func (mq *Mq) declare() error {
+	// dead letter exchange and queue for messages failed to be processed
+	err := mq.ch.ExchangeDeclare(
+		mq.deadLetterExchange(), // name
+		"fanout",                // kind
+		true,                    // durable
+		false,                   // auto-deleted
+		false,                   // internal
+		false,                   // no-wait
+		nil,                     // arguments
+	)
+	if err != nil {
+		return fmt.Errorf("[ERROR] failed to declare dead letter exchange %w", err)
+	}
+
+	_, err = mq.ch.QueueDeclare(
+		mq.deadLetterQueue(), // name
+		true,                 // durable
+		false,                // delete when unused
+		false,                // exclusive
+		false,                // no-wait
+		nil,                  // arguments
+	)
+	if err != nil {
+		return fmt.Errorf("[ERROR] failed to declare dead letter queue %w", err)
+	}
+
+	err = mq.ch.QueueBind(
+		mq.deadLetterQueue(),    // queue name
+		"",                      // routing key
+		mq.deadLetterExchange(), // exchange
+		false,                   // no-wait
+		nil,                     // arguments
+	)
+	if err != nil {
+		return fmt.Errorf("[ERROR] failed to bind dead letter queue %w", err)
+	}
+
+	// parking queue for messages consumer doesn't understand, kept for inspection
+	_, err = mq.ch.QueueDeclare(
+		mq.parkingQueue(), // name
+		true,              // durable
+		false,             // delete when unused
+		false,             // exclusive
+		false,             // no-wait
+		nil,               // arguments
+	)
+	if err != nil {
+		return fmt.Errorf("[ERROR] failed to declare parking queue %w", err)
+	}
+
+	// declare a priority queue for news items, rejected messages go to the dead letter exchange
+	_, err = mq.ch.QueueDeclare(
+		mq.name, // name
+		true,    // durable
+		false,   // delete when unused
+		false,   // exclusive
+		false,   // no-wait
+		amqp.Table{ // arguments
+			"x-dead-letter-exchange": mq.deadLetterExchange(),
+			"x-max-priority":         int32(maxPriority),
+		},
 	)
 	if err != nil {
-		return nil, fmt.Errorf("[ERROR] failed to declare a queue %w", err)
+		return fmt.Errorf("[ERROR] failed to declare a queue %w", err)
+	}
+
+	// delay queues for retries, expired messages are routed back to the main queue
+	for attempt := 1; attempt <= mq.maxRetries; attempt++ {
+		_, err = mq.ch.QueueDeclare(
+			mq.retryQueue(attempt), // name
+			true,                   // durable
+			false,                  // delete when unused
+			false,                  // exclusive
+			false,                  // no-wait
+			amqp.Table{ // arguments
+				"x-message-ttl":             mq.backoff(attempt).Milliseconds(),
+				"x-dead-letter-exchange":    "",
+				"x-dead-letter-routing-key": mq.name,
+			},
+		)
+		if err != nil {
+			return fmt.Errorf("[ERROR] failed to declare retry queue %w", err)
+		}
 	}
 
-	return &Mq{name: cfg.Name, conn: conn, ch: ch}, nil
+	return nil
+}
+
+// deadLetterExchange returns name of the dead letter exchange
+func (mq *Mq) deadLetterExchange() string {
+	return mq.name + ".dlx"
+}
+
+// deadLetterQueue returns name of the queue collecting dead-lettered messages
+func (mq *Mq) deadLetterQueue() string {
+	return mq.name + ".dead"
 }
 
-// Close closes connection to RabbitMQ
+// parkingQueue returns name of the queue collecting messages of unknown version or schema
+func (mq *Mq) parkingQueue() string {
+	return mq.name + ".parking"
+}
+
+// retryQueue returns name of the delay queue for given retry attempt
+func (mq *Mq) retryQueue(attempt int) string {
+	return fmt.Sprintf("%s.retry.%d", mq.name, attempt)
+}
+
+// backoff returns delay before given retry attempt, doubled with every attempt
+func (mq *Mq) backoff(attempt int) time.Duration {
+	return retryPolicy{maxRetries: mq.maxRetries, delay: mq.retryDelay}.backoff(attempt)
+}
+
+// Close stops reconnection and closes connection to RabbitMQ
 func (mq *Mq) Close() error {
+	close(mq.done)
+
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+
 	var err error
 
 	err = mq.ch.Close()
@@ -55,20 +364,80 @@ func (mq *Mq) Close() error {
 		log.Printf("failed to close RabbitMQ connection %v", err)
 	}
 
+	if n := len(mq.buffer); n > 0 {
+		log.Printf("[WARN] %d buffered messages are not published", n)
+	}
+
 	return err
 }
 
-// Publish sends message to RabbitMQ
+// Ping checks that connection and channel to RabbitMQ are open
+func (mq *Mq) Ping(_ context.Context) error {
+	if !mq.connected() {
+		return errors.New("not connected, reconnecting")
+	}
+	if mq.channel().IsClosed() {
+		return errors.New("channel is closed")
+	}
+	return nil
+}
+
+// Publish sends persistent message to RabbitMQ and waits for the broker confirmation,
+// error is returned if the message is nacked or not confirmed in time. While disconnected,
+// the message is buffered and published after reconnection, error is returned if the buffer is full
 func (mq *Mq) Publish(msg []byte) error {
-	err := mq.ch.Publish(
-		"",      // exchange
-		mq.name, // routing key
-		false,   // mandatory
-		false,   // immediate
-		amqp.Publishing{
-			ContentType: "text/plain",
-			Body:        msg,
-		})
+	if mq.connected() {
+		err := mq.publish(msg)
+		if err == nil {
+			queuePublished.Inc()
+			return nil
+		}
+		if !errors.Is(err, amqp.ErrClosed) {
+			queuePublishErrors.Inc()
+			return err
+		}
+		log.Printf("[WARN] %v, buffering", err)
+	}
+
+	return mq.bufferMessage(msg)
+}
+
+// PublishMessage validates and publishes enrichment message as Publish does
+func (mq *Mq) PublishMessage(m EnrichMessage) error {
+	body, err := m.Encode()
+	if err != nil {
+		return fmt.Errorf("[ERROR] failed to encode a message %w", err)
+	}
+
+	return mq.Publish(body)
+}
+
+// TryPublish sends message to RabbitMQ as Publish does, but without buffering,
+// error is returned while disconnected. Used by callers keeping the message
+// until it is published, as the outbox relay does
+func (mq *Mq) TryPublish(msg []byte) error {
+	if !mq.connected() {
+		queuePublishErrors.Inc()
+		return errors.New("[ERROR] failed to publish a message, not connected")
+	}
+
+	err := mq.publish(msg)
+	if err != nil {
+		queuePublishErrors.Inc()
+		return err
+	}
+	queuePublished.Inc()
+
+	return nil
+}
+
+// publish sends message to the main queue on the current channel and waits for confirmation
+func (mq *Mq) publish(msg []byte) error {
+	err := mq.publishConfirmed(mq.name, amqp.Publishing{
+		ContentType: "application/json",
+		Priority:    uint8(messagePriority(msg)),
+		Body:        msg,
+	})
 	if err != nil {
 		return fmt.Errorf("[ERROR] failed to publish a message %w", err)
 	}
@@ -76,16 +445,143 @@ func (mq *Mq) Publish(msg []byte) error {
 	return nil
 }
 
-// Consume returns channel with messages from RabbitMQ
-func (mq *Mq) Consume() (<-chan amqp.Delivery, error) {
-	msgs, err := mq.ch.Consume(
-		mq.name, // queue
-		"",      // consumer
-		true,    // auto-ack
-		false,   // exclusive
-		false,   // no-local
-		false,   // no-wait
-		nil,     // args
+// publishConfirmed sends persistent message to the queue through the default exchange
+// and waits for the broker to confirm it within the publish timeout
+func (mq *Mq) publishConfirmed(queue string, msg amqp.Publishing) error {
+	ctx, cancel := context.WithTimeout(context.Background(), mq.publishTimeout)
+	defer cancel()
+
+	msg.DeliveryMode = amqp.Persistent
+	confirm, err := mq.channel().PublishWithDeferredConfirmWithContext(ctx,
+		"",    // exchange
+		queue, // routing key
+		false, // mandatory
+		false, // immediate
+		msg,
+	)
+	if err != nil {
+		return err
+	}
+
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("not confirmed in %s: %w", mq.publishTimeout, err)
+	}
+	if !acked {
+		return errors.New("nacked by broker")
+	}
+
+	return nil
+}
+
+// bufferMessage keeps message to be published after reconnection
+func (mq *Mq) bufferMessage(msg []byte) error {
+	select {
+	case mq.buffer <- msg:
+		return nil
+	default:
+		queuePublishErrors.Inc()
+		return fmt.Errorf("[ERROR] failed to publish a message, buffer of %d messages is full", cap(mq.buffer))
+	}
+}
+
+// Consume returns channel with messages from RabbitMQ, at most prefetch messages
+// are delivered unacknowledged. Messages must be acknowledged with Ack, Retry or DeadLetter.
+// Consuming is resumed after reconnection, unacknowledged messages are redelivered by the broker.
+// Consuming is cancelled when context is done, the channel is closed after
+// already delivered messages are read
+func (mq *Mq) Consume(ctx context.Context) (<-chan amqp.Delivery, error) {
+	msgs, err := mq.consume()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan amqp.Delivery)
+	go func() {
+		defer close(out)
+
+		cancelled := false
+		done := ctx.Done()
+		for {
+			select {
+			case <-done:
+				err := mq.channel().Cancel(consumerTag, false)
+				if err != nil {
+					log.Printf("failed to cancel RabbitMQ consumer %v", err)
+				}
+				cancelled, done = true, nil
+			case msg, ok := <-msgs:
+				if ok {
+					out <- msg
+					continue
+				}
+				if cancelled || ctx.Err() != nil {
+					return
+				}
+
+				// deliveries stopped without cancel, the connection is lost
+				log.Printf("[WARN] RabbitMQ consumer stopped, waiting for reconnection")
+				msgs, err = mq.resume(ctx)
+				if err != nil {
+					log.Printf("[WARN] RabbitMQ consuming is not resumed: %v", err)
+					return
+				}
+				log.Printf("[INFO] RabbitMQ consuming resumed")
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// ConsumeMessages returns channel with decoded enrichment messages, consumed as Consume does.
+// Messages of unknown version or invalid schema are moved to the parking queue
+func (mq *Mq) ConsumeMessages(ctx context.Context) (<-chan EnrichDelivery, error) {
+	msgs, err := mq.Consume(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan EnrichDelivery)
+	go func() {
+		defer close(out)
+		for msg := range msgs {
+			m, err := DecodeEnrichMessage(msg.Body)
+			if err != nil {
+				log.Printf("[WARN] %v, parking message", err)
+				if err := mq.Park(msg, err); err != nil {
+					log.Printf("[ERROR] %v", err)
+				}
+				continue
+			}
+			out <- EnrichDelivery{Msg: m, Delivery: msg}
+		}
+	}()
+
+	return out, nil
+}
+
+// consume starts consuming the main queue on the current channel
+func (mq *Mq) consume() (<-chan amqp.Delivery, error) {
+	ch := mq.channel()
+
+	err := ch.Qos(
+		mq.prefetch, // prefetch count
+		0,           // prefetch size
+		false,       // global
+	)
+	if err != nil {
+		return nil, fmt.Errorf("[ERROR] failed to set QoS %w", err)
+	}
+
+	msgs, err := ch.Consume(
+		mq.name,     // queue
+		consumerTag, // consumer
+		false,       // auto-ack
+		false,       // exclusive
+		false,       // no-local
+		false,       // no-wait
+		nil,         // args
 	)
 	if err != nil {
 		return nil, fmt.Errorf("[ERROR] failed to consume messages %w", err)
@@ -93,3 +589,130 @@ func (mq *Mq) Consume() (<-chan amqp.Delivery, error) {
 
 	return msgs, nil
 }
+
+// resume waits for reconnection and starts consuming again,
+// error is returned if context is done or Mq is closed meanwhile
+func (mq *Mq) resume(ctx context.Context) (<-chan amqp.Delivery, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-mq.done:
+			return nil, errors.New("connection is closed")
+		case <-mq.readyCh():
+		}
+
+		msgs, err := mq.consume()
+		if err == nil {
+			return msgs, nil
+		}
+
+		// connection loss is not noticed yet, wait for the reconnection
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-mq.done:
+			return nil, errors.New("connection is closed")
+		case <-time.After(reconnectMinDelay):
+		}
+	}
+}
+
+// Ack acknowledges successfully processed message
+func (mq *Mq) Ack(msg amqp.Delivery) error {
+	err := msg.Ack(false)
+	if err != nil {
+		return fmt.Errorf("[ERROR] failed to ack a message %w", err)
+	}
+
+	return nil
+}
+
+// Retry schedules failed message for another attempt through the delay queue
+// and acknowledges the original. Message is dead-lettered when retries are exhausted
+func (mq *Mq) Retry(msg amqp.Delivery) error {
+	attempt := retryCount(msg) + 1
+	if attempt > mq.maxRetries {
+		log.Printf("[WARN] message retries exhausted (%d), dead-lettering", mq.maxRetries)
+		return mq.DeadLetter(msg)
+	}
+
+	headers := amqp.Table{}
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	headers[retryHeader] = int32(attempt)
+
+	// attempt in the message body follows the header
+	body := msg.Body
+	if m, err := DecodeEnrichMessage(msg.Body); err == nil {
+		m.Attempt = attempt
+		if encoded, err := m.Encode(); err == nil {
+			body = encoded
+		}
+	}
+
+	err := mq.publishConfirmed(mq.retryQueue(attempt), amqp.Publishing{
+		Headers:     headers,
+		ContentType: msg.ContentType,
+		Priority:    msg.Priority,
+		Body:        body,
+	})
+	if err != nil {
+		// leave the message to the broker, it goes back to the queue
+		if nackErr := msg.Nack(false, true); nackErr != nil {
+			log.Printf("failed to requeue a message %v", nackErr)
+		}
+		return fmt.Errorf("[ERROR] failed to publish a retry %w", err)
+	}
+	log.Printf("[DEBUG] message scheduled for retry %d/%d in %s", attempt, mq.maxRetries, mq.backoff(attempt))
+
+	return mq.Ack(msg)
+}
+
+// Park moves message to the parking queue with the reason in the header, and acknowledges
+// the original. Message is dead-lettered if it can't be parked
+func (mq *Mq) Park(msg amqp.Delivery, reason error) error {
+	headers := amqp.Table{}
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	headers[parkReasonHeader] = reason.Error()
+
+	err := mq.publishConfirmed(mq.parkingQueue(), amqp.Publishing{
+		Headers:     headers,
+		ContentType: msg.ContentType,
+		Body:        msg.Body,
+	})
+	if err != nil {
+		if dlErr := mq.DeadLetter(msg); dlErr != nil {
+			log.Printf("failed to dead-letter a message %v", dlErr)
+		}
+		return fmt.Errorf("[ERROR] failed to park a message %w", err)
+	}
+
+	return mq.Ack(msg)
+}
+
+// DeadLetter rejects message without requeue, it is routed to the dead letter queue
+func (mq *Mq) DeadLetter(msg amqp.Delivery) error {
+	err := msg.Nack(false, false)
+	if err != nil {
+		return fmt.Errorf("[ERROR] failed to dead-letter a message %w", err)
+	}
+
+	return nil
+}
+
+// retryCount returns number of retries made for the message, taken from the headers
+func retryCount(msg amqp.Delivery) int {
+	switch v := msg.Headers[retryHeader].(type) {
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case int:
+		return v
+	}
+	return 0
+}
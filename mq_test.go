@@ -0,0 +1,169 @@
+// Integration tests for mq.go
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// receive waits for the next message from the channel
+func receive(t *testing.T, msgs <-chan amqp.Delivery) amqp.Delivery {
+	select {
+	case msg := <-msgs:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("message not received")
+	}
+	return amqp.Delivery{}
+}
+
+// Test_MqRetryDeadLetter tests message acknowledgement, retries with backoff
+// and dead-lettering of the message after retries are exhausted
+func Test_MqRetryDeadLetter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg, err := SetupRmqContainer(ctx, t)
+	assert.NoError(t, err)
+
+	mq, err := NewMq(*cfg)
+	assert.NoError(t, err)
+	defer mq.Close()
+
+	msgs, err := mq.Consume(ctx)
+	assert.NoError(t, err)
+
+	// acknowledged message is delivered once
+	err = mq.Publish([]byte("ack"))
+	assert.NoError(t, err)
+	msg := receive(t, msgs)
+	assert.Equal(t, "ack", string(msg.Body))
+	assert.Equal(t, amqp.Persistent, msg.DeliveryMode)
+	assert.Equal(t, 0, retryCount(msg))
+	assert.NoError(t, mq.Ack(msg))
+
+	// failed message comes back with retry count, after the backoff delay
+	err = mq.Publish([]byte("retry"))
+	assert.NoError(t, err)
+	msg = receive(t, msgs)
+	assert.Equal(t, 0, retryCount(msg))
+
+	for attempt := 1; attempt <= cfg.MaxRetries; attempt++ {
+		retried := time.Now()
+		assert.NoError(t, mq.Retry(msg))
+		msg = receive(t, msgs)
+		assert.Equal(t, "retry", string(msg.Body))
+		assert.Equal(t, attempt, retryCount(msg))
+		assert.Equal(t, amqp.Persistent, msg.DeliveryMode)
+		assert.GreaterOrEqual(t, time.Since(retried), mq.backoff(attempt))
+	}
+
+	// retries exhausted, message goes to the dead letter queue
+	assert.NoError(t, mq.Retry(msg))
+
+	time.Sleep(500 * time.Millisecond)
+	dead, ok, err := mq.ch.Get(mq.deadLetterQueue(), true)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "retry", string(dead.Body))
+
+	select {
+	case msg := <-msgs:
+		t.Fatalf("unexpected message: %s", msg.Body)
+	default:
+	}
+}
+
+// Test_MqReconnect tests reconnection after the connection is lost: messages published
+// during the outage are buffered and consuming is resumed
+func Test_MqReconnect(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg, err := SetupRmqContainer(ctx, t)
+	assert.NoError(t, err)
+
+	mq, err := NewMq(*cfg)
+	assert.NoError(t, err)
+	defer mq.Close()
+
+	msgs, err := mq.Consume(ctx)
+	assert.NoError(t, err)
+
+	// drop the connection, as the broker restart does
+	mq.mu.RLock()
+	assert.NoError(t, mq.conn.Close())
+	mq.mu.RUnlock()
+
+	assert.Eventually(t, func() bool { return !mq.connected() }, time.Second, 10*time.Millisecond)
+	assert.Error(t, mq.Ping(ctx))
+
+	// published while disconnected, sent after reconnection
+	err = mq.Publish([]byte("buffered"))
+	assert.NoError(t, err)
+
+	assert.Eventually(t, mq.connected, 5*time.Second, 50*time.Millisecond)
+	assert.NoError(t, mq.Ping(ctx))
+
+	msg := receive(t, msgs)
+	assert.Equal(t, "buffered", string(msg.Body))
+	assert.NoError(t, mq.Ack(msg))
+}
+
+// Test_MqConsumeMessages tests typed messages: valid ones are decoded,
+// messages of unknown version are moved to the parking queue
+func Test_MqConsumeMessages(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg, err := SetupRmqContainer(ctx, t)
+	assert.NoError(t, err)
+
+	mq, err := NewMq(*cfg)
+	assert.NoError(t, err)
+	defer mq.Close()
+
+	msgs, err := mq.ConsumeMessages(ctx)
+	assert.NoError(t, err)
+
+	// invalid message is not published
+	err = mq.PublishMessage(EnrichMessage{Version: 1})
+	assert.ErrorIs(t, err, ErrInvalidMessage)
+
+	err = mq.Publish([]byte(`{"version":99,"news_id":1}`))
+	assert.NoError(t, err)
+
+	sent := NewEnrichMessage(&NewsItem{ID: 1, Link: "https://example.com/news"})
+	err = mq.PublishMessage(sent)
+	assert.NoError(t, err)
+
+	select {
+	case d := <-msgs:
+		assert.Equal(t, sent, d.Msg)
+		assert.Equal(t, "application/json", d.Delivery.ContentType)
+
+		// attempt follows the retries
+		assert.NoError(t, mq.Retry(d.Delivery))
+	case <-time.After(5 * time.Second):
+		t.Fatal("message not received")
+	}
+
+	select {
+	case d := <-msgs:
+		assert.Equal(t, 1, d.Msg.Attempt)
+		assert.Equal(t, sent.CorrelationID, d.Msg.CorrelationID)
+		assert.NoError(t, mq.Ack(d.Delivery))
+	case <-time.After(5 * time.Second):
+		t.Fatal("message not received")
+	}
+
+	parked, ok, err := mq.ch.Get(mq.parkingQueue(), true)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, `{"version":99,"news_id":1}`, string(parked.Body))
+	assert.Contains(t, parked.Headers[parkReasonHeader], "unknown message version")
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// natsTimeout limits waiting for JetStream to set up the stream and to acknowledge published message
+const natsTimeout = 5 * time.Second
+
+// natsQueue is a Queue backed by NATS JetStream. Enrichment messages are persisted in the work queue
+// stream named in config, and removed from it once acknowledged or terminated, under the subjects:
+//   - <stream>.enrich, enrichment messages consumed by the durable <stream>-enrich consumer
+//   - <stream>.reenrich, re-enrichment messages consumed by the separate <stream>-reenrich consumer,
+//     so they don't wait behind new ones
+//
+// Messages taken out of the work are kept for inspection in the separate <stream>-dead stream,
+// limited in age and number, under the subjects:
+//   - <stream>.dead, messages with retries exhausted
+//   - <stream>.parked, messages of unknown version or schema with the reason in the x-park-reason header
+//
+// Message not acknowledged within the visibility timeout (worker crashed) is delivered again
+type natsQueue struct {
+	nc        *nats.Conn
+	js        jetstream.JetStream
+	stream    jetstream.Stream
+	dead      jetstream.Stream
+	consumers [maxPriority + 1]jetstream.Consumer // by message priority
+	name      string
+	retry     retryPolicy
+	prefetch  int
+}
+
+// newNatsQueue connects to NATS and declares the stream and its durable consumers,
+// up to prefetch messages are delivered to every consumer without acknowledgement
+func newNatsQueue(cfg QueueConfig, prefetch int, retry retryPolicy) (*natsQueue, error) {
+	visibility, err := time.ParseDuration(cfg.Visibility)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse queue visibility timeout: %w", err)
+	}
+	deadAge, err := time.ParseDuration(cfg.NatsDeadAge)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse NATS dead messages age: %w", err)
+	}
+
+	nc, err := nats.Connect(cfg.NatsURL, nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			log.Printf("[WARN] NATS connection lost, reconnecting: %v", err)
+		}),
+		nats.ReconnectHandler(func(_ *nats.Conn) {
+			log.Printf("[INFO] NATS connection restored")
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+
+	q := &natsQueue{nc: nc, name: cfg.NatsStream, retry: retry, prefetch: max(prefetch, 1)}
+	if err := q.declare(visibility, deadAge, cfg.NatsDeadMax); err != nil {
+		nc.Close()
+		return nil, err
+	}
+
+	return q, nil
+}
+
+// declare creates or updates the streams and the consumers of enrichment messages,
+// dead and parked messages are kept for up to deadAge, up to deadMax of them
+func (q *natsQueue) declare(visibility, deadAge time.Duration, deadMax int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), natsTimeout)
+	defer cancel()
+
+	js, err := jetstream.New(q.nc)
+	if err != nil {
+		return fmt.Errorf("failed to create JetStream context: %w", err)
+	}
+	q.js = js
+
+	q.stream, err = js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:      q.name,
+		Subjects:  []string{q.subject("enrich"), q.subject("reenrich")},
+		Retention: jetstream.WorkQueuePolicy,
+		Storage:   jetstream.FileStorage,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to declare NATS stream %s: %w", q.name, err)
+	}
+
+	q.dead, err = js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:      q.name + "-dead",
+		Subjects:  []string{q.subject("dead"), q.subject("parked")},
+		Retention: jetstream.LimitsPolicy,
+		Discard:   jetstream.DiscardOld,
+		MaxAge:    deadAge,
+		MaxMsgs:   int64(deadMax),
+		Storage:   jetstream.FileStorage,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to declare NATS stream %s-dead: %w", q.name, err)
+	}
+
+	for priority := range q.consumers {
+		kind := q.kind(priority)
+		q.consumers[priority], err = q.stream.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{
+			Durable:       q.name + "-" + kind,
+			FilterSubject: q.subject(kind),
+			AckPolicy:     jetstream.AckExplicitPolicy,
+			AckWait:       visibility,
+			MaxAckPending: q.prefetch,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to declare NATS %s consumer: %w", kind, err)
+		}
+	}
+
+	return nil
+}
+
+// subject returns stream subject of the kind
+func (q *natsQueue) subject(kind string) string {
+	return q.name + "." + kind
+}
+
+// kind returns kind of the subject of enrichment messages of the priority
+func (q *natsQueue) kind(priority int) string {
+	if priority == PriorityReenrich {
+		return "reenrich"
+	}
+	return "enrich"
+}
+
+// Send implements Queue, the message goes to the subject of its priority and is acknowledged by JetStream
+func (q *natsQueue) Send(payload []byte) error {
+	if err := q.publish(q.subject(q.kind(messagePriority(payload))), payload, nil); err != nil {
+		queuePublishErrors.Inc()
+		return err
+	}
+	queuePublished.Inc()
+
+	return nil
+}
+
+// publish sends message to the subject of the stream and waits for JetStream to store it
+func (q *natsQueue) publish(subject string, payload []byte, header nats.Header) error {
+	ctx, cancel := context.WithTimeout(context.Background(), natsTimeout)
+	defer cancel()
+
+	_, err := q.js.PublishMsg(ctx, &nats.Msg{Subject: subject, Data: payload, Header: header})
+	if err != nil {
+		return fmt.Errorf("failed to publish to %s: %w", subject, err)
+	}
+
+	return nil
+}
+
+// Receive implements Queue, messages of all consumers are delivered to the same channel.
+// Attempt of the message is the number of its earlier deliveries, messages of unknown version
+// or invalid schema are parked
+func (q *natsQueue) Receive(ctx context.Context) (<-chan EnrichDelivery, error) {
+	iterators := make([]jetstream.MessagesContext, 0, len(q.consumers))
+	for _, consumer := range q.consumers {
+		it, err := consumer.Messages(jetstream.PullMaxMessages(q.prefetch))
+		if err != nil {
+			for _, it := range iterators {
+				it.Stop()
+			}
+			return nil, fmt.Errorf("failed to consume NATS messages: %w", err)
+		}
+		iterators = append(iterators, it)
+	}
+
+	go func() {
+		<-ctx.Done()
+		for _, it := range iterators {
+			it.Stop()
+		}
+	}()
+
+	out := make(chan EnrichDelivery)
+	var wg sync.WaitGroup
+	for _, it := range iterators {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.receive(it, out)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	return out, nil
+}
+
+// receive sends decoded messages of the iterator to the channel until the iterator is stopped
+func (q *natsQueue) receive(it jetstream.MessagesContext, out chan<- EnrichDelivery) {
+	for {
+		m, err := it.Next()
+		if errors.Is(err, jetstream.ErrMsgIteratorClosed) {
+			return
+		}
+		if err != nil {
+			log.Printf("[ERROR] failed to receive NATS message: %v", err)
+			continue
+		}
+
+		msg, err := DecodeEnrichMessage(m.Data())
+		if err != nil {
+			log.Printf("[WARN] %v, parking message", err)
+			if err := q.park(m, err); err != nil {
+				log.Printf("[ERROR] %v", err)
+			}
+			continue
+		}
+		if meta, err := m.Metadata(); err == nil {
+			msg.Attempt = int(meta.NumDelivered) - 1
+		}
+		out <- EnrichDelivery{Msg: msg, natsMsg: m}
+	}
+}
+
+// park moves message to the parked subject with the reason in the header, and terminates
+// the original. Message is left for redelivery if it can't be parked
+func (q *natsQueue) park(m jetstream.Msg, reason error) error {
+	header := nats.Header{}
+	header.Set(parkReasonHeader, reason.Error())
+	if err := q.publish(q.subject("parked"), m.Data(), header); err != nil {
+		return fmt.Errorf("failed to park a message: %w", err)
+	}
+	return m.TermWithReason(reason.Error())
+}
+
+// Ack implements Queue
+func (q *natsQueue) Ack(d EnrichDelivery) error {
+	return d.natsMsg.Ack()
+}
+
+// Retry implements Queue, message is redelivered after the backoff delay
+func (q *natsQueue) Retry(d EnrichDelivery) error {
+	attempt := d.Msg.Attempt + 1
+	if attempt > q.retry.maxRetries {
+		log.Printf("[WARN] message retries exhausted (%d), dead-lettering", q.retry.maxRetries)
+		return q.DeadLetter(d)
+	}
+
+	if err := d.natsMsg.NakWithDelay(q.retry.backoff(attempt)); err != nil {
+		return fmt.Errorf("failed to retry a message: %w", err)
+	}
+	log.Printf("[DEBUG] message scheduled for retry %d/%d in %s", attempt, q.retry.maxRetries, q.retry.backoff(attempt))
+
+	return nil
+}
+
+// DeadLetter implements Queue, message is moved to the dead subject
+func (q *natsQueue) DeadLetter(d EnrichDelivery) error {
+	if err := q.publish(q.subject("dead"), d.natsMsg.Data(), nil); err != nil {
+		return fmt.Errorf("failed to dead-letter a message: %w", err)
+	}
+	return d.natsMsg.Term()
+}
+
+// Ping implements Queue, checks the connection and that the streams are available
+func (q *natsQueue) Ping(ctx context.Context) error {
+	if !q.nc.IsConnected() {
+		return errors.New("not connected, reconnecting")
+	}
+	if _, err := q.stream.Info(ctx); err != nil {
+		return err
+	}
+	_, err := q.dead.Info(ctx)
+	return err
+}
+
+// Close implements Queue
+func (q *natsQueue) Close() error {
+	q.nc.Close()
+	return nil
+}
@@ -0,0 +1,124 @@
+// Integration tests for natsqueue.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/stretchr/testify/assert"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// SetupNatsContainer starts a new NATS server with JetStream enabled for testing
+func SetupNatsContainer(ctx context.Context, t *testing.T) string {
+	req := testcontainers.ContainerRequest{
+		Image:        "nats:2.10-alpine",
+		Cmd:          []string{"-js"},
+		ExposedPorts: []string{"4222/tcp"},
+		WaitingFor:   wait.ForLog("Server is ready"),
+	}
+	natsC, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: req,
+		Started:          true,
+	})
+	if err != nil {
+		log.Fatalf("Could not start NATS: %s", err)
+	}
+	// Terminate the container when the test finishes
+	go func() {
+		<-ctx.Done()
+
+		if err := natsC.Terminate(context.Background()); err != nil {
+			log.Printf("Could not stop NATS: %s", err)
+		}
+	}()
+
+	host, err := natsC.Host(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := natsC.MappedPort(ctx, "4222")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return fmt.Sprintf("nats://%s:%s", host, port.Port())
+}
+
+// Test_NatsQueue tests acknowledgement, retries with backoff, dead-lettering, parking,
+// redelivery after visibility timeout and that processed messages leave the work stream
+func Test_NatsQueue(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := QueueConfig{
+		NatsURL:     SetupNatsContainer(ctx, t),
+		NatsStream:  "test",
+		NatsDeadAge: "1h",
+		NatsDeadMax: 100,
+		Visibility:  "1s",
+	}
+	q, err := newNatsQueue(cfg, 10, retryPolicy{maxRetries: 1, delay: 100 * time.Millisecond})
+	assert.NoError(t, err)
+	defer q.Close()
+	assert.NoError(t, q.Ping(ctx))
+
+	// work stream keeps messages until processed, dead stream is bounded
+	info, err := q.stream.Info(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, jetstream.WorkQueuePolicy, info.Config.Retention)
+	info, err = q.dead.Info(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Hour, info.Config.MaxAge)
+	assert.Equal(t, int64(100), info.Config.MaxMsgs)
+
+	msgs, err := q.Receive(ctx)
+	assert.NoError(t, err)
+
+	// unknown version is parked with the reason, valid message is delivered
+	assert.NoError(t, q.Send([]byte(`{"version":99,"news_id":1}`)))
+	sent := NewEnrichMessage(&NewsItem{ID: 1, Link: "https://example.com/news"})
+	payload, err := sent.Encode()
+	assert.NoError(t, err)
+	assert.NoError(t, q.Send(payload))
+
+	d := receiveDelivery(t, msgs)
+	assert.Equal(t, sent, d.Msg)
+
+	parked, err := q.dead.GetLastMsgForSubject(ctx, q.subject("parked"))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"version":99,"news_id":1}`, string(parked.Data))
+	assert.NotEmpty(t, parked.Header.Get(parkReasonHeader))
+
+	// retried message comes back after the backoff with the attempt
+	retried := time.Now()
+	assert.NoError(t, q.Retry(d))
+	d = receiveDelivery(t, msgs)
+	assert.Equal(t, 1, d.Msg.Attempt)
+	assert.GreaterOrEqual(t, time.Since(retried), 100*time.Millisecond)
+
+	// retries exhausted, message is dead
+	assert.NoError(t, q.Retry(d))
+	dead, err := q.dead.GetLastMsgForSubject(ctx, q.subject("dead"))
+	assert.NoError(t, err)
+	assert.Equal(t, payload, dead.Data)
+
+	// not acknowledged message is delivered again after visibility timeout
+	assert.NoError(t, q.Send(payload))
+	first := receiveDelivery(t, msgs)
+	assert.Zero(t, first.Msg.Attempt)
+	again := receiveDelivery(t, msgs)
+	assert.Equal(t, 1, again.Msg.Attempt)
+	assert.NoError(t, q.Ack(again))
+
+	// acknowledged, dead and parked messages are removed from the work stream
+	assert.Eventually(t, func() bool {
+		info, err := q.stream.Info(ctx)
+		return err == nil && info.State.Msgs == 0
+	}, 5*time.Second, 100*time.Millisecond)
+}
@@ -2,10 +2,10 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"regexp"
 	"time"
 
 	"github.com/mmcdole/gofeed"
@@ -13,41 +13,87 @@ import (
 
 // Parser is responsible for parsing RSS feed into slice of items
 type Parser struct {
-	cfg *Config
+	cfg        *Config
+	limiters   *hostLimiters // requests rate per host
+	extractors *Extractors   // article extractors per site
 }
 
-// NewParser constructs new Parser
-func NewParser(cfg *Config) *Parser {
-	return &Parser{cfg: cfg}
+// NewParser constructs new Parser, extractor rules are loaded from the file set in config
+func NewParser(cfg *Config) (*Parser, error) {
+	rules := []ExtractorRule{}
+	if cfg.Extractors != "" {
+		var err error
+		rules, err = LoadExtractorRules(cfg.Extractors)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Parser{
+		cfg:        cfg,
+		limiters:   newHostLimiters(cfg.HostRate, cfg.HostBurst),
+		extractors: NewExtractors(rules),
+	}, nil
+}
+
+// ErrNotModified is returned when feed was not modified since the last fetch (304 response)
+var ErrNotModified = errors.New("feed not modified")
+
+// StatusError is returned when server responds with unexpected status code
+type StatusError struct {
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d", e.Code)
 }
 
 // getContents fetches feed as a string from given URL
 func (p *Parser) getContents(ctx context.Context, url string) (string, error) {
+	body, _, err := p.fetch(ctx, url, http.Header{})
+	return body, err
+}
+
+// fetch requests given URL with additional request headers,
+// returns body and response headers. ErrNotModified is returned on 304 response
+func (p *Parser) fetch(ctx context.Context, url string, header http.Header) (string, http.Header, error) {
+	err := p.limiters.Wait(ctx, url)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to wait for rate limiter: %w", err)
+	}
+
 	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
 	defer cancel()
 
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return "", nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
+	for k, v := range header {
+		req.Header[k] = v
+	}
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/58.0.3029.110 Safari/537.3")
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to get feed: %w", err)
+		return "", nil, fmt.Errorf("failed to get feed: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified {
+		return "", resp.Header, ErrNotModified
+	}
+
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return "", nil, &StatusError{Code: resp.StatusCode}
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read body: %w", err)
+		return "", nil, fmt.Errorf("failed to read body: %w", err)
 	}
 
-	return string(body), nil
+	return string(body), resp.Header, nil
 }
 
 // parseRSS reads RSS feed and returns slice of news items or error.
@@ -73,64 +119,64 @@ func (p *Parser) parseRSS(feedBody string) ([]NewsItem, error) {
 	return items, nil
 }
 
-// GetNews fetches RSS feed, parses it and returns slice of news items or error
-func (p *Parser) GetNews(ctx context.Context) ([]NewsItem, error) {
-	feedBody, err := p.getContents(ctx, p.cfg.RssUrl)
+// GetNews fetches given RSS feed, parses it and returns slice of news items or error.
+// Stored feed validators are sent with the request, ErrNotModified is returned if the
+// feed is not changed. Otherwise validators of the fetched version are returned, the feed
+// is left intact to be fetched in full again if the items are not saved.
+// Items are marked with the feed ID
+func (p *Parser) GetNews(ctx context.Context, feed Feed) ([]NewsItem, FeedValidators, error) {
+	header := http.Header{}
+	if feed.ETag != "" {
+		header.Set("If-None-Match", feed.ETag)
+	}
+	if feed.LastModified != "" {
+		header.Set("If-Modified-Since", feed.LastModified)
+	}
+
+	started := time.Now()
+	feedBody, respHeader, err := p.fetch(ctx, feed.URL, header)
+	observeFeedFetch(feed.URL, started, err)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get feed: %w", err)
+		if errors.Is(err, ErrNotModified) {
+			return nil, FeedValidators{}, ErrNotModified
+		}
+		return nil, FeedValidators{}, fmt.Errorf("failed to get feed: %w", err)
 	}
 
 	items, err := p.parseRSS(feedBody)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse RSS: %w", err)
+		return nil, FeedValidators{}, fmt.Errorf("failed to parse RSS: %w", err)
 	}
 
-	return items, nil
+	for i := range items {
+		items[i].FeedID = feed.ID
+	}
+
+	return items, FeedValidators{ETag: respHeader.Get("ETag"), LastModified: respHeader.Get("Last-Modified")}, nil
 }
 
-// Enrich fetches link contents and extracts enrichment data into NewsItem
+// Enrich fetches link contents and extracts article data into NewsItem,
+// returns number of fields applied
 func (p *Parser) Enrich(ctx context.Context, item *NewsItem) (int, error) {
-	enrichments, err := p.GetEnrichments(ctx, item.Link)
+	article, err := p.GetArticle(ctx, item.Link)
 	if err != nil {
-		return 0, fmt.Errorf("failed to get enrichments: %w", err)
+		return 0, fmt.Errorf("failed to get article: %w", err)
 	}
 
-	item.Description = enrichments["description"]
-	item.Image = enrichments["image"]
-
-	return len(enrichments), nil
+	return article.applyTo(item), nil
 }
 
-// getEnrichments fetches link contents and extracts enrichment data
-func (p *Parser) GetEnrichments(ctx context.Context, link string) (map[string]string, error) {
+// GetArticle fetches link contents and extracts article data with the extractor of the link site
+func (p *Parser) GetArticle(ctx context.Context, link string) (*Article, error) {
 	body, err := p.getContents(ctx, link)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get enrichments: %w", err)
+		return nil, fmt.Errorf("failed to get article page: %w", err)
 	}
 
-	enrichments, err := p.extractEnrichments(body)
+	article, err := extractArticle(body, p.extractors.For(link))
 	if err != nil {
-		return nil, fmt.Errorf("failed to extract enrichments: %w", err)
-	}
-
-	return enrichments, nil
-}
-
-// enrichmentTable is a map of name:regexp pairs for enrichment
-var enrichmentTable = map[string]string{
-	"description": `(?i)<meta[^>]+name="description"[^>]+content="([^"]+)"`,
-	"image":       `(?i)<meta[^>]+property="og:image"[^>]+content="([^"]+)"`,
-}
-
-// extractEnrichments extracts enrichment data from HTML
-func (p *Parser) extractEnrichments(html string) (map[string]string, error) {
-	enrichments := make(map[string]string)
-	for name, re := range enrichmentTable {
-		matches := regexp.MustCompile(re).FindStringSubmatch(html)
-		if len(matches) > 1 {
-			enrichments[name] = matches[1]
-		}
+		return nil, fmt.Errorf("failed to extract article: %w", err)
 	}
 
-	return enrichments, nil
+	return article, nil
 }
@@ -2,6 +2,10 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"testing"
 
@@ -113,6 +117,123 @@ func Test_ParseRSS(t *testing.T) {
 	}
 }
 
+// Test_GetNewsConditional tests that feed validators are returned and sent back,
+// not modified feed is reported with ErrNotModified
+func Test_GetNewsConditional(t *testing.T) {
+	const etag = `"v1"`
+	const lastModified = "Wed, 21 Oct 2015 07:28:00 GMT"
+
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == etag && r.Header.Get("If-Modified-Since") == lastModified {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", lastModified)
+		fmt.Fprint(w, `<rss version="2.0"><channel><title>Test channel</title>
+			<item><title>Test item</title><link>http://example.com</link></item>
+			</channel></rss>`)
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	p, err := NewParser(&Config{})
+	assert.NoError(t, err)
+	feed := Feed{ID: 1, URL: ts.URL}
+
+	// first fetch, validators are returned, the feed is intact
+	items, validators, err := p.GetNews(ctx, feed)
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+	assert.Equal(t, FeedValidators{ETag: etag, LastModified: lastModified}, validators)
+	assert.Empty(t, feed.ETag)
+
+	// second fetch with the validators, not modified
+	feed.ETag, feed.LastModified = validators.ETag, validators.LastModified
+	items, _, err = p.GetNews(ctx, feed)
+	assert.ErrorIs(t, err, ErrNotModified)
+	assert.Empty(t, items)
+	assert.Equal(t, 2, requests)
+
+	// validators changed, full fetch again
+	feed.ETag = `"v0"`
+	items, validators, err = p.GetNews(ctx, feed)
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+	assert.Equal(t, etag, validators.ETag)
+}
+
+// failingSaver is a feedSaver failing to save items the first failures times
+type failingSaver struct {
+	failures   int
+	validators []Feed
+}
+
+func (s *failingSaver) UpsertNewsItems(_ context.Context, items []NewsItem) (UpsertResult, error) {
+	if s.failures > 0 {
+		s.failures--
+		return UpsertResult{}, errors.New("db is down")
+	}
+	res := UpsertResult{}
+	for i := range items {
+		res.Inserted = append(res.Inserted, i+1)
+	}
+	return res, nil
+}
+
+func (s *failingSaver) SaveFeedValidators(_ context.Context, feed *Feed) error {
+	s.validators = append(s.validators, *feed)
+	return nil
+}
+
+// Test_SaveFeedItemsValidators tests that validators are kept until the items are saved,
+// so the feed is fetched in full again after the failed save and not modified after the successful one
+func Test_SaveFeedItemsValidators(t *testing.T) {
+	const etag = `"v1"`
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		fmt.Fprint(w, `<rss version="2.0"><channel><title>Test channel</title>
+			<item><title>Test item</title><link>http://example.com</link></item>
+			</channel></rss>`)
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	p, err := NewParser(&Config{})
+	assert.NoError(t, err)
+	feed := Feed{ID: 1, URL: ts.URL}
+	store := &failingSaver{failures: 1}
+
+	// items are not saved, validators are left intact
+	items, validators, err := p.GetNews(ctx, feed)
+	assert.NoError(t, err)
+	_, err = saveFeedItems(ctx, store, &feed, items, validators)
+	assert.Error(t, err)
+	assert.Empty(t, feed.ETag)
+	assert.Empty(t, store.validators)
+
+	// retry gets the feed in full and saves it
+	items, validators, err = p.GetNews(ctx, feed)
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+	res, err := saveFeedItems(ctx, store, &feed, items, validators)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1}, res.Inserted)
+	assert.Equal(t, etag, feed.ETag)
+	assert.Len(t, store.validators, 1)
+
+	// saved version is not modified
+	_, _, err = p.GetNews(ctx, feed)
+	assert.ErrorIs(t, err, ErrNotModified)
+}
+
 // getFeed, parseRSS and GetNews are tested together. Happy path only
 // kind of integration test
 func Test_GetAndParse(t *testing.T) {
@@ -121,11 +242,8 @@ func Test_GetAndParse(t *testing.T) {
 
 	for _, rssFeed := range validRssFeeds {
 
-		cfg := &Config{
-			RssUrl: rssFeed, // everything parser needs to know
-		}
-
-		p := NewParser(cfg)
+		p, err := NewParser(&Config{})
+		assert.NoError(t, err)
 		feed, err := p.getContents(ctx, rssFeed)
 		assert.NoError(t, err)
 		assert.NotEmpty(t, feed)
@@ -135,47 +253,18 @@ func Test_GetAndParse(t *testing.T) {
 		assert.NoError(t, err)
 		assert.NotEmpty(t, items)
 
-		newsItems, err := p.GetNews(ctx)
+		newsItems, _, err := p.GetNews(ctx, Feed{ID: 1, URL: rssFeed})
 		assert.NoError(t, err)
 		assert.NotEmpty(t, newsItems)
 
+		// items are marked with the feed they came from
+		for i := range items {
+			items[i].FeedID = 1
+		}
 		assert.True(t, reflect.DeepEqual(items, newsItems))
 	}
 }
 
-func Test_ExtractEnrichments(t *testing.T) {
-
-	cases := []struct {
-		name string
-		body string
-		exp  map[string]string
-	}{
-		{"empty", "", map[string]string{}},
-		{"no meta", "<html></html>", map[string]string{}},
-		{"description", `<html>
-		<meta name="description" content="test description">
-		</html>`, map[string]string{"description": "test description"}},
-		{"image", `<html>
-		<meta property="og:image" content="http://example.com/image.jpg">
-		</html>`, map[string]string{"image": "http://example.com/image.jpg"}},
-		{"both", `<html>
-		<meta name="description" content="test description">
-		<meta property="og:image" content="http://example.com/image.jpg">
-		</html>`, map[string]string{"description": "test description", "image": "http://example.com/image.jpg"}},
-	}
-
-	p := Parser{}
-
-	for _, tc := range cases {
-		t.Run(tc.name, func(t *testing.T) {
-			enrichments, err := p.extractEnrichments(tc.body)
-			assert.NoError(t, err)
-			assert.Equal(t, tc.exp, enrichments)
-		})
-	}
-
-}
-
 // fetching and parsing feed, then enriching items
 func Test_ParseRssAndEnrich(t *testing.T) {
 
@@ -183,11 +272,8 @@ func Test_ParseRssAndEnrich(t *testing.T) {
 
 	rssFeed := "https://feeds.bbci.co.uk/news/world/rss.xml"
 
-	cfg := &Config{
-		RssUrl: rssFeed, // everything parser needs to know
-	}
-
-	p := NewParser(cfg)
+	p, err := NewParser(&Config{})
+	assert.NoError(t, err)
 	feed, err := p.getContents(ctx, rssFeed)
 	assert.NoError(t, err)
 	assert.NotEmpty(t, feed)
@@ -200,9 +286,10 @@ func Test_ParseRssAndEnrich(t *testing.T) {
 	for _, item := range items {
 		applied, err := p.Enrich(ctx, &item)
 		assert.NoError(t, err)
-		assert.Equal(t, 2, applied) // 2 enrichments applied
+		assert.GreaterOrEqual(t, applied, 2) // at least description and image applied
 		// check if enrichments are in fact applied
 		assert.NotEmpty(t, item.Description)
 		assert.NotEmpty(t, item.Image)
+		assert.NotEmpty(t, item.Meta)
 	}
 }
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// pgQueue is a Queue backed by the queue_jobs table in Postgres. Workers claim jobs with
+// SELECT ... FOR UPDATE SKIP LOCKED, claimed job not acknowledged within the visibility
+// timeout (worker crashed) is delivered again
+type pgQueue struct {
+	db         *sql.DB
+	retry      retryPolicy
+	batch      int
+	poll       time.Duration
+	visibility time.Duration
+}
+
+// newPgQueue creates Postgres queue, jobs are claimed in batches every poll interval
+func newPgQueue(db *sql.DB, cfg QueueConfig, batch int, retry retryPolicy) (*pgQueue, error) {
+	if db == nil {
+		return nil, errors.New("postgres queue requires DB connection")
+	}
+
+	poll, err := time.ParseDuration(cfg.Poll)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse queue poll interval: %w", err)
+	}
+	visibility, err := time.ParseDuration(cfg.Visibility)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse queue visibility timeout: %w", err)
+	}
+
+	return &pgQueue{
+		db:         db,
+		retry:      retry,
+		batch:      max(batch, 1),
+		poll:       poll,
+		visibility: visibility,
+	}, nil
+}
+
+// Send implements Queue, the message is stored as a pending job of the message priority
+func (q *pgQueue) Send(payload []byte) error {
+	defer observeQuery("queue_send")()
+
+	_, err := q.db.Exec(`INSERT INTO queue_jobs (payload, priority) VALUES ($1, $2)`, payload, messagePriority(payload))
+	if err != nil {
+		queuePublishErrors.Inc()
+		return fmt.Errorf("failed to insert queue job: %w", err)
+	}
+	queuePublished.Inc()
+
+	return nil
+}
+
+// Receive implements Queue, jobs are polled until context is done
+func (q *pgQueue) Receive(ctx context.Context) (<-chan EnrichDelivery, error) {
+	out := make(chan EnrichDelivery)
+	go func() {
+		defer close(out)
+
+		ticker := time.NewTicker(q.poll)
+		defer ticker.Stop()
+		for {
+			deliveries, err := q.claim(ctx)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("[ERROR] %v", err)
+			}
+			for _, d := range deliveries {
+				out <- d
+			}
+
+			// full batch means there are more jobs, no reason to wait
+			if len(deliveries) == q.batch {
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// claim marks a batch of available jobs as processing and returns them, the ones of higher priority first.
+// Jobs with invalid payload are parked
+func (q *pgQueue) claim(ctx context.Context) ([]EnrichDelivery, error) {
+	defer observeQuery("queue_claim")()
+
+	rows, err := q.db.QueryContext(ctx,
+		`UPDATE queue_jobs SET status = 'processing', locked_until = now() + $2 * interval '1 millisecond'
+		WHERE id IN (
+			SELECT id FROM queue_jobs
+			WHERE (status = 'pending' AND available_at <= now())
+				OR (status = 'processing' AND locked_until < now())
+			ORDER BY priority DESC, id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, payload, attempt`,
+		q.batch, q.visibility.Milliseconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim queue jobs: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := []EnrichDelivery{}
+	parked := map[int64]error{}
+	for rows.Next() {
+		var id int64
+		var payload []byte
+		var attempt int
+		if err := rows.Scan(&id, &payload, &attempt); err != nil {
+			return nil, fmt.Errorf("failed to scan queue job: %w", err)
+		}
+
+		msg, err := DecodeEnrichMessage(payload)
+		if err != nil {
+			parked[id] = err
+			continue
+		}
+		msg.Attempt = attempt
+		deliveries = append(deliveries, EnrichDelivery{Msg: msg, jobID: id})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read queue jobs: %w", err)
+	}
+
+	for id, reason := range parked {
+		log.Printf("[WARN] %v, parking job %d", reason, id)
+		if err := q.setStatus(id, "parked", reason.Error()); err != nil {
+			log.Printf("[ERROR] %v", err)
+		}
+	}
+
+	return deliveries, nil
+}
+
+// setStatus sets final status of the job, with the reason
+func (q *pgQueue) setStatus(id int64, status, reason string) error {
+	defer observeQuery("queue_set_status")()
+
+	_, err := q.db.Exec(`UPDATE queue_jobs SET status = $2, last_error = $3 WHERE id = $1`, id, status, reason)
+	if err != nil {
+		return fmt.Errorf("failed to set queue job %d %s: %w", id, status, err)
+	}
+
+	return nil
+}
+
+// Ack implements Queue, processed job is deleted
+func (q *pgQueue) Ack(d EnrichDelivery) error {
+	defer observeQuery("queue_ack")()
+
+	_, err := q.db.Exec(`DELETE FROM queue_jobs WHERE id = $1`, d.jobID)
+	if err != nil {
+		return fmt.Errorf("failed to ack queue job %d: %w", d.jobID, err)
+	}
+
+	return nil
+}
+
+// Retry implements Queue, job becomes available again after the backoff delay
+func (q *pgQueue) Retry(d EnrichDelivery) error {
+	attempt := d.Msg.Attempt + 1
+	if attempt > q.retry.maxRetries {
+		log.Printf("[WARN] message retries exhausted (%d), dead-lettering", q.retry.maxRetries)
+		return q.DeadLetter(d)
+	}
+
+	defer observeQuery("queue_retry")()
+
+	_, err := q.db.Exec(
+		`UPDATE queue_jobs
+		SET status = 'pending', attempt = $2, available_at = now() + $3 * interval '1 millisecond', locked_until = NULL
+		WHERE id = $1`,
+		d.jobID, attempt, q.retry.backoff(attempt).Milliseconds())
+	if err != nil {
+		return fmt.Errorf("failed to retry queue job %d: %w", d.jobID, err)
+	}
+	log.Printf("[DEBUG] message scheduled for retry %d/%d in %s", attempt, q.retry.maxRetries, q.retry.backoff(attempt))
+
+	return nil
+}
+
+// DeadLetter implements Queue, job is kept with dead status
+func (q *pgQueue) DeadLetter(d EnrichDelivery) error {
+	return q.setStatus(d.jobID, "dead", "")
+}
+
+// Ping implements Queue
+func (q *pgQueue) Ping(ctx context.Context) error {
+	return q.db.PingContext(ctx)
+}
+
+// Close implements Queue, DB connection is owned by Storage and is left open
+func (q *pgQueue) Close() error {
+	return nil
+}
@@ -0,0 +1,83 @@
+// Integration tests for pgqueue.go
+package main
+
+import (
+	"context"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test_PgQueue tests claiming jobs, acknowledgement, retries with backoff,
+// dead-lettering, parking and redelivery after visibility timeout
+func Test_PgQueue(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg, err := SetupPgContainer(ctx, t)
+	assert.NoError(t, err)
+
+	err = migrateDb(cfg, "up")
+	assert.NoError(t, err)
+	defer func() {
+		err := migrateDb(cfg, "down")
+		if err != nil {
+			log.Fatalf("failed to migrate down: %v", err)
+		}
+	}()
+
+	store, err := NewStorage(*cfg)
+	assert.NoError(t, err)
+	defer store.Close()
+
+	q, err := newPgQueue(store.db, QueueConfig{Poll: "50ms", Visibility: "500ms"}, 10,
+		retryPolicy{maxRetries: 1, delay: 100 * time.Millisecond})
+	assert.NoError(t, err)
+	assert.NoError(t, q.Ping(ctx))
+
+	msgs, err := q.Receive(ctx)
+	assert.NoError(t, err)
+
+	// unknown version is parked, valid message is delivered
+	assert.NoError(t, q.Send([]byte(`{"version":99,"news_id":1}`)))
+	sent := NewEnrichMessage(&NewsItem{ID: 1, Link: "https://example.com/news"})
+	payload, err := sent.Encode()
+	assert.NoError(t, err)
+	assert.NoError(t, q.Send(payload))
+
+	d := receiveDelivery(t, msgs)
+	assert.Equal(t, sent, d.Msg)
+
+	var parked int
+	err = store.db.QueryRow(`SELECT count(*) FROM queue_jobs WHERE status = 'parked'`).Scan(&parked)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, parked)
+
+	// retried job comes back after the backoff with the attempt
+	retried := time.Now()
+	assert.NoError(t, q.Retry(d))
+	d = receiveDelivery(t, msgs)
+	assert.Equal(t, 1, d.Msg.Attempt)
+	assert.GreaterOrEqual(t, time.Since(retried), 100*time.Millisecond)
+
+	// retries exhausted, job is dead
+	assert.NoError(t, q.Retry(d))
+	var status string
+	err = store.db.QueryRow(`SELECT status FROM queue_jobs WHERE id = $1`, d.jobID).Scan(&status)
+	assert.NoError(t, err)
+	assert.Equal(t, "dead", status)
+
+	// not acknowledged job is delivered again after visibility timeout
+	assert.NoError(t, q.Send(payload))
+	first := receiveDelivery(t, msgs)
+	again := receiveDelivery(t, msgs)
+	assert.Equal(t, first.jobID, again.jobID)
+
+	assert.NoError(t, q.Ack(again))
+	var pending int
+	err = store.db.QueryRow(`SELECT count(*) FROM queue_jobs WHERE status IN ('pending', 'processing')`).Scan(&pending)
+	assert.NoError(t, err)
+	assert.Zero(t, pending)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// queryBuilder collects SQL conditions with their arguments, passed as positional parameters
+type queryBuilder struct {
+	conds []string
+	args  []any
+}
+
+// arg adds argument and returns its placeholder
+func (b *queryBuilder) arg(v any) string {
+	b.args = append(b.args, v)
+	return "$" + strconv.Itoa(len(b.args))
+}
+
+// where adds condition, every ? in it is replaced with placeholder of the next argument
+func (b *queryBuilder) where(cond string, args ...any) {
+	for _, v := range args {
+		cond = strings.Replace(cond, "?", b.arg(v), 1)
+	}
+	b.conds = append(b.conds, cond)
+}
+
+// whereSQL returns WHERE clause of all conditions, empty if there are none
+func (b *queryBuilder) whereSQL() string {
+	if len(b.conds) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(b.conds, "\n\t\tAND ")
+}
+
+// presence returns condition on text column being empty or not
+func presence(column string, present bool) string {
+	if present {
+		return column + " <> ''"
+	}
+	return column + " = ''"
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_QueryBuilder(t *testing.T) {
+	b := &queryBuilder{}
+	assert.Empty(t, b.whereSQL())
+
+	from := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	b.where("feed_id = ?", 1)
+	b.where("published >= ? AND published < ?", from, from.AddDate(0, 0, 1))
+	b.where(presence("image", true))
+	q := b.arg("search terms")
+	b.where("search @@ websearch_to_tsquery('english', " + q + ")")
+	b.where(presence("description", false))
+
+	assert.Equal(t, "WHERE feed_id = $1\n\t\tAND published >= $2 AND published < $3\n\t\tAND image <> ''"+
+		"\n\t\tAND search @@ websearch_to_tsquery('english', $4)\n\t\tAND description = ''", b.whereSQL())
+	assert.Equal(t, []any{1, from, from.AddDate(0, 0, 1), "search terms"}, b.args)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Queue delivers enrichment messages from the outbox relay to the enrichment workers
+type Queue interface {
+	// Send publishes encoded enrichment message, error is returned if the queue didn't accept it
+	Send(payload []byte) error
+	// Receive returns channel with decoded messages, every message must be acknowledged
+	// with Ack, Retry or DeadLetter. Messages of unknown version or invalid schema are parked.
+	// Receiving stops when context is done, the channel is closed after that
+	Receive(ctx context.Context) (<-chan EnrichDelivery, error)
+	// Ack acknowledges successfully processed message
+	Ack(d EnrichDelivery) error
+	// Retry schedules failed message for another attempt with backoff,
+	// message is dead-lettered when retries are exhausted
+	Retry(d EnrichDelivery) error
+	// DeadLetter moves message out of the queue without further attempts
+	DeadLetter(d EnrichDelivery) error
+	// Ping checks that the queue is operational
+	Ping(ctx context.Context) error
+	// Close releases queue resources
+	Close() error
+}
+
+// Queue backends, selected with QueueConfig.Backend
+const (
+	QueueAMQP     = "amqp"
+	QueueMemory   = "memory"
+	QueuePostgres = "postgres"
+	QueueNATS     = "nats"
+)
+
+// NewQueue creates queue of the backend set in config, db is used by the Postgres backend
+func NewQueue(cfg *Config, db *sql.DB) (Queue, error) {
+	retryDelay, err := time.ParseDuration(cfg.RMQ.RetryDelay)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse retry delay: %w", err)
+	}
+	retry := retryPolicy{maxRetries: cfg.RMQ.MaxRetries, delay: retryDelay}
+
+	switch cfg.Queue.Backend {
+	case QueueAMQP, "":
+		mq, err := NewMq(cfg.RMQ)
+		if err != nil {
+			return nil, err
+		}
+		return &amqpQueue{mq: mq}, nil
+	case QueueMemory:
+		return newMemQueue(cfg.Queue.Size, retry), nil
+	case QueuePostgres:
+		return newPgQueue(db, cfg.Queue, cfg.RMQ.Prefetch, retry)
+	case QueueNATS:
+		return newNatsQueue(cfg.Queue, cfg.RMQ.Prefetch, retry)
+	default:
+		return nil, fmt.Errorf("unknown queue backend %q", cfg.Queue.Backend)
+	}
+}
+
+// retryPolicy limits number of retries and sets backoff between them
+type retryPolicy struct {
+	maxRetries int
+	delay      time.Duration // delay of the first retry, doubled with every next one
+}
+
+// backoff returns delay before given retry attempt
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	return p.delay * time.Duration(1<<(attempt-1))
+}
+
+// amqpQueue is a Queue backed by RabbitMQ
+type amqpQueue struct {
+	mq *Mq
+}
+
+// Send implements Queue, the message is confirmed by the broker
+func (q *amqpQueue) Send(payload []byte) error {
+	return q.mq.TryPublish(payload)
+}
+
+// Receive implements Queue
+func (q *amqpQueue) Receive(ctx context.Context) (<-chan EnrichDelivery, error) {
+	return q.mq.ConsumeMessages(ctx)
+}
+
+// Ack implements Queue
+func (q *amqpQueue) Ack(d EnrichDelivery) error {
+	return q.mq.Ack(d.Delivery)
+}
+
+// Retry implements Queue, the message goes through the delay queue of the attempt
+func (q *amqpQueue) Retry(d EnrichDelivery) error {
+	return q.mq.Retry(d.Delivery)
+}
+
+// DeadLetter implements Queue, the message goes to the dead letter queue
+func (q *amqpQueue) DeadLetter(d EnrichDelivery) error {
+	return q.mq.DeadLetter(d.Delivery)
+}
+
+// Ping implements Queue
+func (q *amqpQueue) Ping(ctx context.Context) error {
+	return q.mq.Ping(ctx)
+}
+
+// Close implements Queue
+func (q *amqpQueue) Close() error {
+	return q.mq.Close()
+}
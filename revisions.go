@@ -0,0 +1,98 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+// diffPart is a run of words of the text diff
+type diffPart struct {
+	Text string
+	Op   string // "del" for removed, "ins" for inserted, empty for unchanged words
+}
+
+// historyEntry is a change of news item, from the previous version to the next one
+type historyEntry struct {
+	ChangedAt     time.Time
+	Title         []diffPart
+	PrevPublished time.Time
+	Published     time.Time // differs from PrevPublished if publication time was changed
+}
+
+// buildHistory returns changes of the news item from the previous versions to the current one, latest first
+func buildHistory(item *NewsItem, revisions []NewsRevision) []historyEntry {
+	history := make([]historyEntry, 0, len(revisions))
+	for i, rev := range revisions {
+		title, published := item.Title, item.Published
+		if i+1 < len(revisions) {
+			title, published = revisions[i+1].Title, revisions[i+1].Published
+		}
+		history = append(history, historyEntry{
+			ChangedAt:     rev.ChangedAt,
+			Title:         wordDiff(rev.Title, title),
+			PrevPublished: rev.Published,
+			Published:     published,
+		})
+	}
+
+	// latest first
+	for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
+		history[i], history[j] = history[j], history[i]
+	}
+
+	return history
+}
+
+// wordDiff returns word level diff of two texts, based on the longest common subsequence of words.
+// Adjacent words with the same operation are joined into one part
+func wordDiff(a, b string) []diffPart {
+	aw, bw := strings.Fields(a), strings.Fields(b)
+
+	// lcs[i][j] is the length of the longest common subsequence of aw[i:] and bw[j:]
+	lcs := make([][]int, len(aw)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(bw)+1)
+	}
+	for i := len(aw) - 1; i >= 0; i-- {
+		for j := len(bw) - 1; j >= 0; j-- {
+			if aw[i] == bw[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+				continue
+			}
+			lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+		}
+	}
+
+	parts := []diffPart{}
+	add := func(word, op string) {
+		if n := len(parts); n > 0 && parts[n-1].Op == op {
+			parts[n-1].Text += " " + word
+			return
+		}
+		parts = append(parts, diffPart{Text: word, Op: op})
+	}
+
+	i, j := 0, 0
+	for i < len(aw) && j < len(bw) {
+		switch {
+		case aw[i] == bw[j]:
+			add(aw[i], "")
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			add(aw[i], "del")
+			i++
+		default:
+			add(bw[j], "ins")
+			j++
+		}
+	}
+	for ; i < len(aw); i++ {
+		add(aw[i], "del")
+	}
+	for ; j < len(bw); j++ {
+		add(bw[j], "ins")
+	}
+
+	return parts
+}
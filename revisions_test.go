@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_WordDiff(t *testing.T) {
+	cases := []struct {
+		name string
+		a, b string
+		want []diffPart
+	}{
+		{name: "same", a: "Storm hits coast", b: "Storm hits coast", want: []diffPart{{Text: "Storm hits coast"}}},
+		{name: "empty", want: []diffPart{}},
+		{
+			name: "word replaced",
+			a:    "Storm hits the coast",
+			b:    "Hurricane hits the coast",
+			want: []diffPart{{Text: "Storm", Op: "del"}, {Text: "Hurricane", Op: "ins"}, {Text: "hits the coast"}},
+		},
+		{
+			name: "words appended",
+			a:    "Storm hits coast",
+			b:    "Storm hits coast, thousands evacuated",
+			want: []diffPart{{Text: "Storm hits"}, {Text: "coast", Op: "del"}, {Text: "coast, thousands evacuated", Op: "ins"}},
+		},
+		{
+			name: "words removed",
+			a:    "Live: Storm hits coast",
+			b:    "Storm hits coast",
+			want: []diffPart{{Text: "Live:", Op: "del"}, {Text: "Storm hits coast"}},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, wordDiff(tc.a, tc.b))
+		})
+	}
+}
+
+func Test_BuildHistory(t *testing.T) {
+	published := time.Date(2024, 7, 1, 10, 0, 0, 0, time.UTC)
+	item := &NewsItem{ID: 1, Title: "Third title", Published: published.Add(time.Hour)}
+	revisions := []NewsRevision{
+		{NewsID: 1, Title: "First title", Published: published, ChangedAt: published.Add(time.Hour)},
+		{NewsID: 1, Title: "Second title", Published: published, ChangedAt: published.Add(2 * time.Hour)},
+	}
+
+	history := buildHistory(item, revisions)
+	assert.Len(t, history, 2)
+
+	// latest change goes first, to the current version
+	assert.Equal(t, published.Add(2*time.Hour), history[0].ChangedAt)
+	assert.Equal(t, []diffPart{{Text: "Second", Op: "del"}, {Text: "Third", Op: "ins"}, {Text: "title"}}, history[0].Title)
+	assert.Equal(t, published, history[0].PrevPublished)
+	assert.Equal(t, published.Add(time.Hour), history[0].Published)
+
+	assert.Equal(t, []diffPart{{Text: "First", Op: "del"}, {Text: "Second", Op: "ins"}, {Text: "title"}}, history[1].Title)
+	assert.Equal(t, history[1].PrevPublished, history[1].Published)
+
+	assert.Empty(t, buildHistory(item, nil))
+}
+
+func Test_HistoryHandler(t *testing.T) {
+	published := time.Date(2024, 7, 1, 10, 0, 0, 0, time.UTC)
+	storage := &stubStorer{
+		news: []NewsItem{{ID: 1, Title: "Hurricane hits coast", Published: published, Revisions: 1}},
+		revisions: []NewsRevision{
+			{NewsID: 1, Title: "Storm hits coast", Published: published, ChangedAt: published.Add(time.Hour)},
+		},
+	}
+	api, err := NewAPIServer(storage, APIConfig{})
+	assert.NoError(t, err)
+	router := api.router(context.Background())
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/article/history?id=1", http.NoBody))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "<del>Storm</del> <ins>Hurricane</ins> hits coast")
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/article?id=1", http.NoBody))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `href="/article/history?id=1"`)
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/article/history?id=2", http.NoBody))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func Test_HistoryTitleEscaped(t *testing.T) {
+	published := time.Date(2024, 7, 1, 10, 0, 0, 0, time.UTC)
+	storage := &stubStorer{
+		news:      []NewsItem{{ID: 1, Title: "<script>alert(1)</script>", Published: published, Revisions: 1}},
+		revisions: []NewsRevision{{NewsID: 1, Title: "Storm", Published: published, ChangedAt: published.Add(time.Hour)}},
+	}
+	api, err := NewAPIServer(storage, APIConfig{})
+	assert.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	api.router(context.Background()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/article/history?id=1", http.NoBody))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "<script>alert(1)")
+	assert.Contains(t, rec.Body.String(), "&lt;script&gt;alert(1)&lt;/script&gt;")
+}
@@ -5,6 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -13,21 +16,42 @@ type Service struct {
 	Parser    *Parser
 	Storage   *Storage
 	ApiServer *APIServer
-	Mq        *Mq
+	Queue     Queue
+	pollsMu   sync.Mutex
+	polls     map[string]feedPoll // last successful polls of the polled feeds, by URL
+}
+
+// feedPoll is the last successful poll of the feed polled every ttl
+type feedPoll struct {
+	ttl    time.Duration
+	polled time.Time
 }
 
 func NewService(cfg *Config) (*Service, error) {
 
-	parser := NewParser(cfg)
+	parser, err := NewParser(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start parser: %w", err)
+	}
 
 	storage, err := NewStorage(cfg.DB)
 	if err != nil {
 		return nil, fmt.Errorf("failed to start storage: %w", err)
 	}
 
-	mq, err := NewMq(cfg.RMQ)
+	err = subscribeFeeds(storage, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe feeds: %w", err)
+	}
+
+	// news saved by earlier versions have no canonical links, they are matched by the original ones meanwhile
+	if err := canonicalizeLinks(storage); err != nil {
+		log.Printf("[WARN] failed to canonicalize links: %v", err)
+	}
+
+	queue, err := NewQueue(cfg, storage.db)
 	if err != nil {
-		return nil, fmt.Errorf("failed to start RabbitMQ: %w", err)
+		return nil, fmt.Errorf("failed to start %s queue: %w", cfg.Queue.Backend, err)
 	}
 
 	api, err := NewAPIServer(storage, cfg.API)
@@ -35,36 +59,220 @@ func NewService(cfg *Config) (*Service, error) {
 		return nil, fmt.Errorf("failed to start API server: %w", err)
 	}
 
-	return &Service{
+	s := &Service{
 		cfg:       cfg,
 		Parser:    parser,
 		Storage:   storage,
-		Mq:        mq,
+		Queue:     queue,
 		ApiServer: api,
-	}, nil
+		polls:     map[string]feedPoll{},
+	}
+
+	api.AddReadyCheck("postgres", storage.Ping)
+	api.AddReadyCheck("queue", queue.Ping)
+	api.AddReadyCheck("feeds", s.checkFeedsFresh)
+
+	return s, nil
 }
 
-// ParsingJob runs parsing job with given interval, saves items to DB and publishes to the queue
+// checkFeedsFresh checks that the last successful poll of every polled feed is within StaleFactor x its TTL,
+// stale feeds are listed in the error
+func (s *Service) checkFeedsFresh(_ context.Context) error {
+	s.pollsMu.Lock()
+	defer s.pollsMu.Unlock()
+
+	stale := []string{}
+	for url, poll := range s.polls {
+		staleAfter := time.Duration(max(s.cfg.StaleFactor, 1)) * poll.ttl
+		if since := time.Since(poll.polled); since > staleAfter {
+			stale = append(stale, fmt.Sprintf("%s not polled for %s, last poll at %s",
+				url, since.Round(time.Second), poll.polled.Format(time.RFC3339)))
+		}
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+	slices.Sort(stale)
+	return fmt.Errorf("%d of %d feeds stale: %s", len(stale), len(s.polls), strings.Join(stale, "; "))
+}
+
+// markPolled records successful poll of the feed
+func (s *Service) markPolled(feed Feed, ttl time.Duration) {
+	s.pollsMu.Lock()
+	defer s.pollsMu.Unlock()
+	s.polls[feed.URL] = feedPoll{ttl: ttl, polled: time.Now()}
+}
+
+// markStarted records the feed as polled when its polling starts, unless it was polled before
+func (s *Service) markStarted(feed Feed, ttl time.Duration) {
+	s.pollsMu.Lock()
+	defer s.pollsMu.Unlock()
+	if _, ok := s.polls[feed.URL]; !ok {
+		s.polls[feed.URL] = feedPoll{ttl: ttl, polled: time.Now()}
+	}
+}
+
+// forgetPolls removes the feed not polled anymore from the freshness check
+func (s *Service) forgetPolls(feed Feed) {
+	s.pollsMu.Lock()
+	defer s.pollsMu.Unlock()
+	delete(s.polls, feed.URL)
+}
+
+// subscribeFeeds adds feeds from config to the feeds table, already subscribed feeds stay as they are
+func subscribeFeeds(storage *Storage, cfg *Config) error {
+	ttl, err := time.ParseDuration(cfg.RssTtl)
+	if err != nil {
+		log.Println("failed to parse RSS TTL, using default 15m")
+		ttl = 15 * time.Minute
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, url := range cfg.RssUrls {
+		feed := Feed{URL: url, TTL: ttl, Enabled: true}
+		err := storage.CreateFeed(ctx, &feed)
+		if err != nil {
+			return fmt.Errorf("failed to save feed %s: %w", url, err)
+		}
+		log.Printf("[DEBUG] feed subscribed: %+v", feed)
+	}
+
+	return nil
+}
+
+// canonicalizeLinks sets canonical links of news saved without them
+func canonicalizeLinks(storage *Storage) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	updated, err := storage.CanonicalizeLinks(ctx, 1000)
+	if updated > 0 {
+		log.Printf("[INFO] canonical links set for %d news", updated)
+	}
+	return err
+}
+
+// ParsingJob runs polling loop for every enabled feed, feeds are reloaded from the feeds table
+// every FeedsReload interval. Waits for the loops to finish
 func (s *Service) ParsingJob(ctx context.Context) {
 	log.Println("starting parsing job ...")
 
-	ttl, err := time.ParseDuration(s.cfg.RssTtl)
+	interval, err := time.ParseDuration(s.cfg.FeedsReload)
+	if err != nil || interval <= 0 {
+		log.Println("failed to parse feeds reload interval, using default 1m")
+		interval = time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	runs := map[int]*feedRun{}
+	for {
+		s.reloadFeeds(ctx, runs)
+		select {
+		case <-ctx.Done():
+			for _, run := range runs {
+				<-run.done
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// feedRun is the running polling loop of the feed
+type feedRun struct {
+	feed   Feed
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// reloadFeeds starts polling loops of the enabled feeds, stops the ones of feeds disabled or removed
+// meanwhile and restarts the ones of feeds with URL or TTL changed. Loops given up on failing feeds
+// are started again, the feeds are kept stale until polled successfully
+func (s *Service) reloadFeeds(ctx context.Context, runs map[int]*feedRun) {
+	feeds, err := s.Storage.GetFeeds(ctx)
 	if err != nil {
-		log.Println("failed to parse RSS TTL, using default 15m")
+		log.Printf("[ERROR] failed to get feeds: %v", err)
+		return
+	}
+
+	enabled := map[int]Feed{}
+	for _, feed := range feeds {
+		enabled[feed.ID] = feed
+	}
+	for id, run := range runs {
+		feed, ok := enabled[id]
+		changed := !ok || feed.URL != run.feed.URL || feed.TTL != run.feed.TTL
+		select {
+		case <-run.done:
+			delete(runs, id)
+			if changed {
+				s.forgetPolls(run.feed)
+			}
+			continue
+		default:
+		}
+		if !changed {
+			continue
+		}
+		log.Printf("[INFO] feed %s changed or disabled, stopping", run.feed.URL)
+		run.cancel()
+		<-run.done
+		delete(runs, id)
+		s.forgetPolls(run.feed)
+	}
+
+	for _, feed := range feeds {
+		if _, ok := runs[feed.ID]; ok {
+			continue
+		}
+		log.Printf("[INFO] polling feed %s", feed.URL)
+		feedCtx, cancel := context.WithCancel(ctx)
+		run := &feedRun{feed: feed, cancel: cancel, done: make(chan struct{})}
+		runs[feed.ID] = run
+		go func() {
+			defer close(run.done)
+			defer cancel()
+			s.FeedJob(feedCtx, feed)
+		}()
+	}
+}
+
+// FeedJob polls single feed with its TTL interval, saves items to DB and their links to the outbox.
+// Changes of title or publication time of already saved items are recorded as revisions
+func (s *Service) FeedJob(ctx context.Context, feed Feed) {
+	ttl := feed.TTL
+	if ttl <= 0 {
+		log.Printf("invalid TTL of feed %s, using default 15m", feed.URL)
 		ttl = 15 * time.Minute
 	}
 
+	// feed is considered fresh on start, the first poll is made right away
+	s.markStarted(feed, ttl)
+
 	ticker := time.NewTicker(ttl)
+	defer ticker.Stop()
 	retry, limit := 0, 3
 	for {
-		log.Println("parsing RSS feed")
-		items, err := s.Parser.GetNews(ctx)
+		log.Printf("parsing RSS feed %s", feed.URL)
+		items, validators, err := s.Parser.GetNews(ctx, feed)
+		if errors.Is(err, ErrNotModified) {
+			retry = 0
+			s.markPolled(feed, ttl)
+			log.Printf("[DEBUG] feed %s not modified", feed.URL)
+			if !s.waitNextPoll(ctx, ticker, feed) {
+				return
+			}
+			continue
+		}
 		if err != nil {
 			if retry > limit {
-				log.Printf("[ERROR] failed to parse RSS: %v, exiting", err)
+				log.Printf("[ERROR] failed to parse RSS %s: %v, exiting", feed.URL, err)
 				return
 			}
-			log.Printf("failed to parse RSS: %v, retrying in 30 sec %d/%d", err, retry, limit)
+			log.Printf("failed to parse RSS %s: %v, retrying in 30 sec %d/%d", feed.URL, err, retry, limit)
 			retry++
 			select {
 			case <-ctx.Done():
@@ -74,72 +282,306 @@ func (s *Service) ParsingJob(ctx context.Context) {
 			}
 		}
 		retry = 0
-		log.Printf("parsed %d items", len(items))
+		s.markPolled(feed, ttl)
+		log.Printf("parsed %d items from %s", len(items), feed.URL)
+		feedItems.WithLabelValues(feed.URL, "parsed").Add(float64(len(items)))
 
-		// Saving items to DB
-		saved, skipped := 0, 0
-		for _, item := range items {
-			err := s.Storage.CreateNewsItem(ctx, &item)
-			if err != nil {
-				if errors.Is(err, ErrAlreadyExists) {
-					log.Printf("[DEBUG] item already exists: %v", item)
-					skipped++
-					continue
-				}
-				log.Printf("[ERROR] failed to save item: %v", err)
-				continue
+		// Saving items to DB, item links are published to the queue from the outbox by OutboxJob
+		res, err := saveFeedItems(ctx, s.Storage, &feed, items, validators)
+		if err != nil {
+			log.Printf("[ERROR] failed to save items: %v", err)
+			feedItems.WithLabelValues(feed.URL, "failed").Add(float64(len(items)))
+			if !s.waitNextPoll(ctx, ticker, feed) {
+				return
 			}
-			saved++
+			continue
+		}
+		log.Printf("[INFO] %s: %d news saved, %d revised, %d duplicates skipped, %d invalid",
+			feed.URL, len(res.Inserted), len(res.Updated), res.Skipped, res.Invalid)
+		feedItems.WithLabelValues(feed.URL, "saved").Add(float64(len(res.Inserted)))
+		feedItems.WithLabelValues(feed.URL, "revised").Add(float64(len(res.Updated)))
+		feedItems.WithLabelValues(feed.URL, "skipped").Add(float64(res.Skipped))
+		feedItems.WithLabelValues(feed.URL, "failed").Add(float64(res.Invalid))
 
-			// log.Printf("[DEBUG] item saved: %v", item)
+		if !s.waitNextPoll(ctx, ticker, feed) {
+			return
+		}
+	}
+}
 
-			// publish item link to the queue
-			err = s.Mq.Publish([]byte(item.Link))
+// feedSaver saves polled feed items and validators, implemented by Storage
+type feedSaver interface {
+	UpsertNewsItems(ctx context.Context, items []NewsItem) (UpsertResult, error)
+	SaveFeedValidators(ctx context.Context, feed *Feed) error
+}
+
+// saveFeedItems saves items of the fetched feed version, then sets its validators to the feed
+// and saves them for conditional requests. Validators are left intact if the items are not saved,
+// so the next poll fetches the feed in full instead of getting it not modified
+func saveFeedItems(ctx context.Context, store feedSaver, feed *Feed, items []NewsItem, validators FeedValidators) (UpsertResult, error) {
+	res, err := store.UpsertNewsItems(ctx, items)
+	if err != nil {
+		return res, err
+	}
+
+	feed.ETag, feed.LastModified = validators.ETag, validators.LastModified
+	if err := store.SaveFeedValidators(ctx, feed); err != nil {
+		log.Printf("[ERROR] failed to save feed validators: %v", err)
+	}
+
+	return res, nil
+}
+
+// OutboxJob publishes pending outbox messages to the queue and marks them sent, until the
+// outbox is empty, then waits for the next poll. Sent messages are pruned once an hour
+func (s *Service) OutboxJob(ctx context.Context) {
+	poll, err := time.ParseDuration(s.cfg.OutboxPoll)
+	if err != nil || poll <= 0 {
+		log.Printf("invalid outbox poll interval %q, using default 1s", s.cfg.OutboxPoll)
+		poll = time.Second
+	}
+	keep, err := time.ParseDuration(s.cfg.OutboxKeep)
+	if err != nil {
+		log.Printf("invalid outbox keep duration %q, using default 24h", s.cfg.OutboxKeep)
+		keep = 24 * time.Hour
+	}
+	batch := max(s.cfg.OutboxBatch, 1)
+
+	log.Println("starting outbox job ...")
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+	pruned := time.Now()
+
+	for {
+		for {
+			sent, err := s.Storage.RelayOutbox(ctx, batch, s.Queue.Send)
+			if err != nil {
+				log.Printf("[WARN] outbox relay: %v", err)
+				break
+			}
+			if sent > 0 {
+				log.Printf("[DEBUG] %d outbox messages published", sent)
+			}
+			if sent < batch {
+				break
+			}
+		}
+
+		if time.Since(pruned) > time.Hour {
+			deleted, err := s.Storage.PruneOutbox(ctx, time.Now().Add(-keep))
 			if err != nil {
-				log.Printf("[ERROR] failed to publish to queue: %v", err)
+				log.Printf("[ERROR] %v", err)
+			} else {
+				log.Printf("[DEBUG] %d sent outbox messages pruned", deleted)
 			}
+			pruned = time.Now()
 		}
-		log.Printf("[INFO] %d news saved, %d duplicates skipped", saved, skipped)
 
 		select {
 		case <-ticker.C:
-			// ttl expired, parse again
-			continue
 		case <-ctx.Done():
-			log.Printf("parsing job stopped: %v", ctx.Err())
+			log.Printf("outbox job stopped: %v", ctx.Err())
 			return
 		}
 	}
 }
 
-// EnrichmentJob consumes links from the queue, gets news item from DB, enriches it and saves back
+// ReenrichJob periodically re-queues news published within the window for enrichment: items with
+// empty description or image and items enriched long ago, the most incomplete first, up to the limit.
+// The same item is not requested again until the retry time passes
+func (s *Service) ReenrichJob(ctx context.Context) {
+	cfg := s.cfg.Reenrich
+	interval, err := time.ParseDuration(cfg.Interval)
+	if err != nil {
+		log.Printf("invalid re-enrichment interval %q, using default 1h", cfg.Interval)
+		interval = time.Hour
+	}
+	if interval <= 0 {
+		log.Println("re-enrichment job is disabled")
+		return
+	}
+	stale, err := time.ParseDuration(cfg.Stale)
+	if err != nil {
+		log.Printf("invalid re-enrichment stale age %q, using default 24h", cfg.Stale)
+		stale = 24 * time.Hour
+	}
+	retry, err := time.ParseDuration(cfg.Retry)
+	if err != nil {
+		log.Printf("invalid re-enrichment retry time %q, using default 6h", cfg.Retry)
+		retry = 6 * time.Hour
+	}
+	window, err := time.ParseDuration(cfg.Window)
+	if err != nil {
+		log.Printf("invalid re-enrichment window %q, using default 168h", cfg.Window)
+		window = 7 * 24 * time.Hour
+	}
+
+	log.Println("starting re-enrichment job ...")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			log.Printf("re-enrichment job stopped: %v", ctx.Err())
+			return
+		}
+
+		now := time.Now()
+		queued, err := s.Storage.RequeueNews(ctx, ReenrichFilter{
+			From:            now.Add(-window),
+			EnrichedBefore:  now.Add(-stale),
+			RequestedBefore: now.Add(-retry),
+			Limit:           max(cfg.Limit, 1),
+		})
+		if err != nil {
+			log.Printf("[ERROR] failed to re-queue news: %v", err)
+			continue
+		}
+		log.Printf("[INFO] %d news re-queued for enrichment", queued)
+	}
+}
+
+// waitNextPoll waits for the feed TTL to expire, returns false if the job should stop
+func (s *Service) waitNextPoll(ctx context.Context, ticker *time.Ticker, feed Feed) bool {
+	select {
+	case <-ticker.C:
+		// ttl expired, parse again
+		return true
+	case <-ctx.Done():
+		log.Printf("parsing job for %s stopped: %v", feed.URL, ctx.Err())
+		return false
+	}
+}
+
+// EnrichmentJob consumes enrichment messages from the queue with a pool of workers, every worker
+// gets news item from DB, enriches it and saves back. Failed messages are retried with backoff, then
+// dead-lettered. On termination consuming stops, in-flight messages are processed within the grace
+// period and cancelled after it, the job returns when all of them are done
 func (s *Service) EnrichmentJob(ctx context.Context) {
-	newsCh, err := s.Mq.Consume()
+	grace, err := time.ParseDuration(s.cfg.EnrichGrace)
+	if err != nil {
+		log.Printf("invalid enrichment grace period %q, using default 30s", s.cfg.EnrichGrace)
+		grace = 30 * time.Second
+	}
+
+	newsCh, err := s.Queue.Receive(ctx)
 	if err != nil {
 		log.Fatalf("failed to consume messages: %v", err)
 	}
-	log.Println("starting enrichment job ...")
 
-	for msg := range newsCh {
-		link := string(msg.Body)
-		log.Printf("[DEBUG] enriching news: %s", link)
+	workers := max(s.cfg.EnrichWorkers, 1)
+	log.Printf("starting enrichment job with %d workers ...", workers)
 
-		err := s.EnrichNewsItem(ctx, link)
+	// in-flight messages outlive the job context for the grace period
+	workCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-workCtx.Done():
+			return
+		}
+		select {
+		case <-time.After(grace):
+			log.Printf("[WARN] in-flight enrichments are not finished in %s, cancelling", grace)
+			cancel()
+		case <-workCtx.Done():
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.enrichmentWorker(workCtx, newsCh)
+		}()
+	}
+	wg.Wait()
+	log.Println("enrichment job stopped")
+}
+
+// enrichmentWorker processes messages from the channel until it is closed
+func (s *Service) enrichmentWorker(ctx context.Context, newsCh <-chan EnrichDelivery) {
+	for d := range newsCh {
+		log.Printf("[DEBUG] enriching news id=%d %s, attempt %d, correlation %s",
+			d.Msg.NewsID, d.Msg.Link, d.Msg.Attempt, d.Msg.CorrelationID)
+
+		err := s.EnrichNewsItem(ctx, d.Msg)
+		if err == nil {
+			err = s.Queue.Ack(d)
+			if err != nil {
+				log.Printf("[ERROR] %v", err)
+			}
+			continue
+		}
+		log.Printf("[ERROR] failed to enrich news, correlation %s: %v", d.Msg.CorrelationID, err)
+
+		// unknown item won't appear on retry, no reason to wait for it
+		if errors.Is(err, ErrNotFound) {
+			err = s.Queue.DeadLetter(d)
+		} else {
+			err = s.Queue.Retry(d)
+		}
 		if err != nil {
-			log.Printf("[ERROR] failed to enrich news: %v", err)
+			log.Printf("[ERROR] %v", err)
 		}
 	}
 }
 
-// EnrichNewsItem enriches news item with additional data
-func (s *Service) EnrichNewsItem(ctx context.Context, link string) error {
+// EnrichNewsItem applies enrichments requested by the message to the news item
+func (s *Service) EnrichNewsItem(ctx context.Context, msg EnrichMessage) (err error) {
+	started := time.Now()
+	defer func() {
+		enrichmentDuration.Observe(time.Since(started).Seconds())
+		if err != nil {
+			enrichments.WithLabelValues("failure").Inc()
+			return
+		}
+		enrichments.WithLabelValues("success").Inc()
+	}()
+
 	// get news item from DB
-	newsItem, err := s.Storage.GetNewsItem(ctx, link)
+	newsItem, err := s.Storage.GetSingleNews(ctx, msg.NewsID)
 	if err != nil {
 		log.Printf("[ERROR] failed to get item from DB: %v", err)
 		return fmt.Errorf("failed to get item from DB: %w", err)
 	}
 
+	if !msg.Wants(EnrichArticle) {
+		return nil
+	}
+
+	// the attempt is recorded whatever the outcome
+	err = s.enrichArticle(ctx, newsItem)
+	recordEnrichment(ctx, s.Storage, newsItem.ID, err)
+
+	return err
+}
+
+// enrichmentSaveTimeout limits saving the result of the enrichment cancelled on shutdown
+const enrichmentSaveTimeout = 5 * time.Second
+
+// enrichmentRecorder records enrichment attempts, implemented by Storage
+type enrichmentRecorder interface {
+	SaveEnrichmentResult(ctx context.Context, id int, enrichErr error) error
+}
+
+// recordEnrichment saves the result of the enrichment attempt of the news item. The enrichment
+// cancelled after the shutdown grace period is recorded as failed too, the context is not cancelled with it
+func recordEnrichment(ctx context.Context, store enrichmentRecorder, id int, enrichErr error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), enrichmentSaveTimeout)
+	defer cancel()
+
+	if err := store.SaveEnrichmentResult(ctx, id, enrichErr); err != nil {
+		log.Printf("[ERROR] failed to save enrichment status of id=%d: %v", id, err)
+	}
+}
+
+// enrichArticle extracts article data from the page of news item and saves it
+func (s *Service) enrichArticle(ctx context.Context, newsItem *NewsItem) error {
 	// enrich news item
 	applied, err := s.Parser.Enrich(ctx, newsItem)
 	if err != nil {
@@ -160,12 +602,30 @@ func (s *Service) EnrichNewsItem(ctx context.Context, link string) error {
 }
 
 // Run starts the service and waits for termination signal
-// Parsing and Enrichment jobs run in background
+// Parsing, outbox, enrichment and re-enrichment jobs run in background, connections are closed after they stop
 func (s *Service) Run(ctx context.Context) {
+	var jobs sync.WaitGroup
 
-	go s.ParsingJob(ctx)
+	jobs.Add(4)
+	go func() {
+		defer jobs.Done()
+		s.ParsingJob(ctx)
+	}()
 
-	go s.EnrichmentJob(ctx)
+	go func() {
+		defer jobs.Done()
+		s.OutboxJob(ctx)
+	}()
+
+	go func() {
+		defer jobs.Done()
+		s.EnrichmentJob(ctx)
+	}()
+
+	go func() {
+		defer jobs.Done()
+		s.ReenrichJob(ctx)
+	}()
 
 	go func() {
 		err := s.ApiServer.Run(ctx)
@@ -178,9 +638,12 @@ func (s *Service) Run(ctx context.Context) {
 	// wait for termination signal
 	<-ctx.Done()
 
-	err := s.Mq.Close()
+	// let the jobs finish in-flight work
+	jobs.Wait()
+
+	err := s.Queue.Close()
 	if err != nil {
-		log.Printf("failed to close RabbitMQ: %v", err)
+		log.Printf("failed to close queue: %v", err)
 	}
 
 	err = s.Storage.Close()
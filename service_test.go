@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// stubRecorder is an enrichmentRecorder failing on the cancelled context, as the database does
+type stubRecorder struct {
+	results map[int]error
+}
+
+func (r *stubRecorder) SaveEnrichmentResult(ctx context.Context, id int, enrichErr error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.results[id] = enrichErr
+	return nil
+}
+
+// Test_RecordEnrichmentCancelled tests that the enrichment cancelled on shutdown is recorded as failed
+// and retried
+func Test_RecordEnrichmentCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	rec := &stubRecorder{results: map[int]error{}}
+	enrichErr := fmt.Errorf("failed to enrich news: %w", ctx.Err())
+	recordEnrichment(ctx, rec, 1, enrichErr)
+
+	assert.Contains(t, rec.results, 1)
+	assert.ErrorIs(t, rec.results[1], context.Canceled)
+	assert.False(t, errors.Is(enrichErr, ErrNotFound), "cancelled enrichment is retried, not dead-lettered")
+
+	recordEnrichment(context.Background(), rec, 2, nil)
+	assert.Contains(t, rec.results, 2)
+	assert.NoError(t, rec.results[2])
+}
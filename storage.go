@@ -1,10 +1,15 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/lib/pq"
@@ -32,44 +37,72 @@ func NewStorage(cfg DBConfig) (*Storage, error) {
 	return &Storage{db: db}, nil
 }
 
-// CreateNewsItem saves news item to DB. Minimum required fields are Title and Link
+// CreateNewsItem saves news item to DB. Minimum required fields are Title and Link.
+// Enrichment message is written to the outbox in the same transaction, to be published to the queue
 func (s *Storage) CreateNewsItem(ctx context.Context, item *NewsItem) error {
+	defer observeQuery("create_news_item")()
 
 	if item == nil || item.Title == "" || item.Link == "" {
 		return errors.New("item is empty")
 	}
 
-	args := []any{item.Title, item.Link, item.Published}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck // no-op after commit
+
+	item.CanonicalLink = canonicalLink(item.Link)
+	args := []any{item.Title, item.Link, item.CanonicalLink, item.Published, item.FeedID}
 
-	err := s.db.QueryRowContext(ctx,
-		`INSERT INTO news (title, link, published)
-		VALUES ($1, $2, $3::timestamp)
+	// the link can be the canonical one of another article page
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO news (title, link, canonical_link, published, feed_id)
+		SELECT $1, $2, $3, $4::timestamp, NULLIF($5, 0)
+		WHERE NOT EXISTS (SELECT 1 FROM news WHERE article_link = $3)
 		RETURNING id`,
 		args...).Scan(&item.ID)
 
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrAlreadyExists
+		}
 		pgErr, ok := err.(*pq.Error)
-		// check if item already exists, return special error
+		// check if item already exists by link or canonical link, return special error
 		if ok && pgErr.Code == "23505" {
 			return ErrAlreadyExists
 		}
+		return err
 	}
 
-	return err
+	if err := assignClusters(ctx, tx, []int{item.ID}); err != nil {
+		return err
+	}
+
+	payload, err := NewEnrichMessage(item).Encode()
+	if err != nil {
+		return fmt.Errorf("failed to encode enrichment message: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO outbox (payload) VALUES ($1)`, payload)
+	if err != nil {
+		return fmt.Errorf("failed to write outbox: %w", err)
+	}
+
+	return tx.Commit()
 }
 
-// GetNewsItem returns news item by Link
+// GetNewsItem returns news item by Link, or by canonical link of the feed link or article page
 func (s *Storage) GetNewsItem(ctx context.Context, link string) (*NewsItem, error) {
+	defer observeQuery("get_news_item")()
+
 	item := NewsItem{}
-	err := s.db.QueryRowContext(ctx,
-		`SELECT id, title, link, published, description, image FROM news WHERE link = $1`,
-		link).Scan(
-		&item.ID,
-		&item.Title,
-		&item.Link,
-		&item.Published,
-		&item.Description,
-		&item.Image)
+	err := scanNewsItem(s.db.QueryRowContext(ctx,
+		`SELECT `+newsColumns+` FROM news
+		WHERE link = $1 OR canonical_link = $2 OR article_link = $2
+		ORDER BY link = $1 DESC, canonical_link = $2 DESC, id
+		LIMIT 1`,
+		link, canonicalLink(link)), &item)
 
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -81,21 +114,399 @@ func (s *Storage) GetNewsItem(ctx context.Context, link string) (*NewsItem, erro
 	return &item, nil
 }
 
-// SaveNewsItem updates news item in DB
+// SaveNewsItem updates news item in DB, the item is put to the story cluster again
+// as the fingerprint changes with the description. Canonical link of the article page
+// is saved as ArticleLink, to match other links of the same article
 func (s *Storage) SaveNewsItem(ctx context.Context, item *NewsItem) error {
-	res, err := s.db.ExecContext(ctx,
-		`UPDATE news SET title = $1, link = $2, description = $3, image = $4 WHERE id = $5
-		RETURNING id
+	defer observeQuery("save_news_item")()
+
+	meta, err := json.Marshal(item.Meta)
+	if err != nil {
+		return fmt.Errorf("failed to marshal meta: %w", err)
+	}
+	if item.Meta == nil {
+		meta = []byte("{}")
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck // no-op after commit
+
+	err = tx.QueryRowContext(ctx,
+		`UPDATE news SET title = $1, link = $2, description = $3, image = $4,
+			body = $5, authors = $6, section = $7, tags = $8, canonical_url = $9,
+			article_published = $10, article_modified = $11, meta = $12, publisher = $13,
+			canonical_link = CASE WHEN link = $2 THEN canonical_link ELSE $15 END,
+			article_link = NULLIF($16, '')
+		WHERE id = $14
+		RETURNING COALESCE(canonical_link, ''), COALESCE(article_link, '')
 		`,
 		item.Title,
 		item.Link,
 		item.Description,
 		item.Image,
-		item.ID)
+		item.Body,
+		pq.Array(nonNil(item.Authors)),
+		item.Section,
+		pq.Array(nonNil(item.Tags)),
+		item.CanonicalURL,
+		item.ArticlePublished,
+		item.ArticleModified,
+		meta,
+		item.Publisher,
+		item.ID,
+		canonicalLink(item.Link),
+		articleLink(*item)).Scan(&item.CanonicalLink, &item.ArticleLink)
 
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		pgErr, ok := err.(*pq.Error)
+		// changed link can be taken by another item
+		if ok && pgErr.Code == "23505" {
+			return ErrAlreadyExists
+		}
+		return err
+	}
+
+	if err := assignClusters(ctx, tx, []int{item.ID}); err != nil {
 		return err
 	}
+	return tx.Commit()
+}
+
+// UpsertResult is the outcome of UpsertNewsItems
+type UpsertResult struct {
+	Inserted []int // ids of new items
+	Updated  []int // ids of known items with changed title or publication time
+	Skipped  int   // unchanged known items and repeated links of the batch
+	Invalid  int   // items without title or link
+}
+
+// UpsertNewsItems saves parsed news items in one statement, new items are inserted and known ones
+// (by canonical link of the feed link or article page) are updated if their title or publication time changed, the previous
+// version is recorded to news_revisions. Only items of the same feed are updated, known items of other feeds
+// are duplicates and skipped. Enrichment messages of new items are written to the outbox
+// in the same transaction. IDs of all saved items are set, unchanged known ones included
+func (s *Storage) UpsertNewsItems(ctx context.Context, items []NewsItem) (UpsertResult, error) {
+	defer observeQuery("upsert_news_items")()
+
+	res := UpsertResult{}
+	// the same row can't be updated twice by one statement, so repeated links are skipped,
+	// links differing in tracking parameters only are the same
+	index := map[string]int{}
+	titles, links, canonical, published, feeds := []string{}, []string{}, []string{}, []string{}, []int64{}
+	for i, item := range items {
+		if item.Title == "" || item.Link == "" {
+			res.Invalid++
+			continue
+		}
+		key := canonicalLink(item.Link)
+		if _, ok := index[key]; ok {
+			res.Skipped++
+			continue
+		}
+		index[key] = i
+		titles = append(titles, item.Title)
+		links = append(links, item.Link)
+		canonical = append(canonical, key)
+		published = append(published, item.Published.Format(time.RFC3339Nano))
+		feeds = append(feeds, int64(item.FeedID))
+	}
+	if len(links) == 0 {
+		return res, nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return UpsertResult{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck // no-op after commit
+
+	// all parts of the statement see the same snapshot, so old has the values before the update.
+	// Known items are matched by the canonical link of the article page too, and by the original link
+	// if they were saved without canonical one. Several items of the batch can match the same known one,
+	// it's updated by one of them only: the item with the same canonical link, or the first in the batch.
+	// Unchanged items are not updated, only their ids are returned. Published is stored as timestamp, as in CreateNewsItem
+	rows, err := tx.QueryContext(ctx,
+		`WITH input AS (
+			SELECT * FROM unnest($1::text[], $2::text[], $3::text[], $4::text[], $5::int[]) WITH ORDINALITY
+				AS t(title, link, canonical_link, published, feed_id, ord)
+		),
+		old AS (
+			SELECT news.id, news.title, news.published, input.canonical_link AS input_link,
+				news.feed_id IS NOT DISTINCT FROM NULLIF(input.feed_id, 0) AS same_feed,
+				news.canonical_link IS NOT DISTINCT FROM input.canonical_link AS same_link,
+				input.ord
+			FROM news
+			JOIN input ON input.canonical_link IN (news.canonical_link, news.article_link) OR input.link = news.link
+			FOR UPDATE OF news
+		),
+		target AS (
+			SELECT DISTINCT ON (id) id, input_link FROM old
+			WHERE same_feed
+			ORDER BY id, same_link DESC, ord
+		),
+		updated AS (
+			UPDATE news SET title = input.title, published = input.published::timestamp
+			FROM target JOIN input ON input.canonical_link = target.input_link
+			WHERE news.id = target.id
+				AND (news.title <> input.title OR news.published <> input.published::timestamp)
+			RETURNING news.id, input.canonical_link, 'updated' AS change
+		),
+		inserted AS (
+			INSERT INTO news (title, link, canonical_link, published, feed_id)
+			SELECT title, link, canonical_link, published::timestamp, NULLIF(feed_id, 0) FROM input
+			WHERE NOT EXISTS (SELECT 1 FROM old WHERE old.input_link = input.canonical_link)
+			ON CONFLICT DO NOTHING
+			RETURNING id, canonical_link, 'inserted' AS change
+		),
+		revisions AS (
+			INSERT INTO news_revisions (news_id, title, published)
+			SELECT DISTINCT old.id, old.title, old.published FROM old
+			JOIN updated ON updated.id = old.id
+		)
+		SELECT id, canonical_link, change FROM updated
+		UNION ALL
+		SELECT id, canonical_link, change FROM inserted
+		UNION ALL
+		SELECT old.id, old.input_link, 'unchanged' FROM old
+		WHERE NOT EXISTS (SELECT 1 FROM updated WHERE updated.id = old.id AND updated.canonical_link = old.input_link)
+		ORDER BY id`,
+		pq.Array(titles), pq.Array(links), pq.Array(canonical), pq.Array(published), pq.Array(feeds))
+	if err != nil {
+		return UpsertResult{}, fmt.Errorf("failed to upsert news: %w", err)
+	}
+
+	payloads := []string{}
+	for rows.Next() {
+		var id int
+		var key, change string
+		if err := rows.Scan(&id, &key, &change); err != nil {
+			rows.Close()
+			return UpsertResult{}, fmt.Errorf("failed to scan upserted news: %w", err)
+		}
+		item := &items[index[key]]
+		item.ID = id
+
+		switch change {
+		case "unchanged":
+			continue
+		case "updated":
+			res.Updated = append(res.Updated, id)
+			continue
+		}
+		res.Inserted = append(res.Inserted, id)
+		item.CanonicalLink = key
+
+		payload, err := NewEnrichMessage(item).Encode()
+		if err != nil {
+			rows.Close()
+			return UpsertResult{}, fmt.Errorf("failed to encode enrichment message: %w", err)
+		}
+		payloads = append(payloads, string(payload))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return UpsertResult{}, fmt.Errorf("failed to read upserted news: %w", err)
+	}
+	res.Skipped += len(links) - len(res.Inserted) - len(res.Updated)
+
+	// updated titles change the fingerprints too
+	if err := assignClusters(ctx, tx, append(slices.Clone(res.Inserted), res.Updated...)); err != nil {
+		return UpsertResult{}, err
+	}
+
+	if len(payloads) > 0 {
+		_, err = tx.ExecContext(ctx, `INSERT INTO outbox (payload) SELECT unnest($1::text[])`, pq.Array(payloads))
+		if err != nil {
+			return UpsertResult{}, fmt.Errorf("failed to write outbox: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return UpsertResult{}, fmt.Errorf("failed to commit upsert: %w", err)
+	}
+
+	return res, nil
+}
+
+// clusterLock is the key of the advisory lock serializing story cluster assignment
+const clusterLock = 7_246_001
+
+// assignClusters saves fingerprints of the saved news items and puts every item to the story cluster
+// of the nearest one published within clusterWindow, items of the batch are matched with each other too.
+// Assignments are serialized, so concurrent transactions see items clustered by each other. When the
+// first item of the cluster, which the cluster is named after, leaves it, the rest of the cluster is
+// named after the next item
+func assignClusters(ctx context.Context, tx *sql.Tx, ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	// held until the transaction ends, statements after it see items committed meanwhile
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, clusterLock); err != nil {
+		return fmt.Errorf("failed to lock story clusters: %w", err)
+	}
+
+	keys := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, int64(id))
+	}
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT id, title, description, published, COALESCE(story_cluster_id, id) FROM news
+		WHERE id = ANY($1::int[])
+		ORDER BY id`,
+		pq.Array(keys))
+	if err != nil {
+		return fmt.Errorf("failed to get clustered news: %w", err)
+	}
+	saved := []storyFingerprint{}
+	batch := map[int]int{} // previous clusters of the batch items
+	for rows.Next() {
+		item, cluster := NewsItem{}, 0
+		if err := rows.Scan(&item.ID, &item.Title, &item.Description, &item.Published, &cluster); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan clustered news: %w", err)
+		}
+		saved = append(saved, storyFingerprint{ID: item.ID, Published: item.Published, Fingerprint: fingerprint(item)})
+		batch[item.ID] = cluster
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read clustered news: %w", err)
+	}
+	if len(saved) == 0 {
+		return nil
+	}
+
+	from, to := saved[0].Published, saved[0].Published
+	for _, item := range saved {
+		if item.Published.Before(from) {
+			from = item.Published
+		}
+		if item.Published.After(to) {
+			to = item.Published
+		}
+	}
+
+	rows, err = tx.QueryContext(ctx,
+		`SELECT id, published, fingerprint, COALESCE(story_cluster_id, id) FROM news
+		WHERE fingerprint IS NOT NULL AND published BETWEEN $1::timestamp AND $2::timestamp`,
+		from.Add(-clusterWindow), to.Add(clusterWindow))
+	if err != nil {
+		return fmt.Errorf("failed to get story fingerprints: %w", err)
+	}
+	candidates := []storyFingerprint{}
+	for rows.Next() {
+		c, fp := storyFingerprint{}, int64(0)
+		if err := rows.Scan(&c.ID, &c.Published, &fp, &c.ClusterID); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan story fingerprint: %w", err)
+		}
+		// previous fingerprints of the batch items are outdated
+		if _, ok := batch[c.ID]; ok {
+			continue
+		}
+		c.Fingerprint = uint64(fp)
+		candidates = append(candidates, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read story fingerprints: %w", err)
+	}
+
+	keys, fps, clusters, moved := keys[:0], make([]int64, 0, len(saved)), make([]int64, 0, len(saved)), []int64{}
+	for i := range saved {
+		cluster, matched := nearestCluster(candidates, saved[i])
+		saved[i].ClusterID = cluster
+		candidates = append(candidates, saved[i])
+		keys = append(keys, int64(saved[i].ID))
+		fps = append(fps, int64(saved[i].Fingerprint))
+		clusters = append(clusters, int64(saved[i].ClusterID))
+		// the first item doesn't match the rest of its cluster anymore
+		if id := saved[i].ID; batch[id] == id && (cluster != id || !matched) {
+			moved = append(moved, int64(id))
+		}
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE news SET fingerprint = t.fingerprint, story_cluster_id = t.cluster_id
+		FROM unnest($1::int[], $2::bigint[], $3::int[]) AS t(id, fingerprint, cluster_id)
+		WHERE news.id = t.id`,
+		pq.Array(keys), pq.Array(fps), pq.Array(clusters))
+	if err != nil {
+		return fmt.Errorf("failed to save story clusters: %w", err)
+	}
+
+	if len(moved) == 0 {
+		return nil
+	}
+	_, err = tx.ExecContext(ctx,
+		`UPDATE news SET story_cluster_id = renamed.id
+		FROM (
+			SELECT story_cluster_id, min(id) AS id FROM news
+			WHERE story_cluster_id = ANY($1::int[]) AND id <> story_cluster_id
+			GROUP BY story_cluster_id
+		) AS renamed
+		WHERE news.story_cluster_id = renamed.story_cluster_id`,
+		pq.Array(moved))
+	if err != nil {
+		return fmt.Errorf("failed to rename story clusters: %w", err)
+	}
+
+	return nil
+}
+
+// GetRevisions returns previous versions of the news item, oldest first
+func (s *Storage) GetRevisions(ctx context.Context, newsID int) ([]NewsRevision, error) {
+	defer observeQuery("get_revisions")()
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, news_id, title, published, changed_at FROM news_revisions
+		WHERE news_id = $1
+		ORDER BY changed_at, id`,
+		newsID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get revisions: %w", err)
+	}
+	defer rows.Close()
+
+	revisions := []NewsRevision{}
+	for rows.Next() {
+		rev := NewsRevision{}
+		if err := rows.Scan(&rev.ID, &rev.NewsID, &rev.Title, &rev.Published, &rev.ChangedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan revision: %w", err)
+		}
+		revisions = append(revisions, rev)
+	}
+
+	return revisions, rows.Err()
+}
+
+// SaveEnrichmentResult records enrichment attempt of the news item, failed if enrichErr is not nil.
+// Successfully enriched item gets enriched_at set and the last error cleared
+func (s *Storage) SaveEnrichmentResult(ctx context.Context, id int, enrichErr error) error {
+	defer observeQuery("save_enrichment_result")()
+
+	status, lastError := EnrichmentSuccess, ""
+	if enrichErr != nil {
+		status, lastError = EnrichmentFailed, enrichErr.Error()
+	}
+
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE news SET enrichment_status = $2, last_error = $3,
+			enrichment_attempts = enrichment_attempts + 1,
+			enriched_at = CASE WHEN $4 THEN now() ELSE enriched_at END
+		WHERE id = $1`,
+		id, status, lastError, enrichErr == nil)
+	if err != nil {
+		return fmt.Errorf("failed to save enrichment result: %w", err)
+	}
 
 	affected, err := res.RowsAffected()
 	if affected == 0 {
@@ -105,16 +516,109 @@ func (s *Storage) SaveNewsItem(ctx context.Context, item *NewsItem) error {
 	return err
 }
 
+// nonNil returns empty slice instead of nil, to store it as empty array, not NULL
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+// GetNews returns page of news items and pagination metadata. Items are optionally
+// filtered by feed, publication date range, presence of image and description, story cluster
+// and full-text search query, search results have highlighted snippets. Story clusters are
+// optionally collapsed to the latest item. Pages are fetched by keyset of the listing order
+// (rank for relevance, published, id) from the cursor, so new items don't shift them
 func (s *Storage) GetNews(ctx context.Context, filters Filters) ([]NewsItem, Metadata, error) {
+	defer observeQuery("get_news")()
+
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
+	b := &queryBuilder{}
+	rank, snippet := "0::real", "''"
+	if filters.Query != "" {
+		tsquery := "websearch_to_tsquery('english', " + b.arg(filters.Query) + ")"
+		b.where("search @@ " + tsquery)
+		rank = "ts_rank(search, " + tsquery + ")"
+		snippet = "ts_headline('english', description, " + tsquery + ", 'StartSel=<mark>, StopSel=</mark>, MaxFragments=2')"
+	}
+	if filters.FeedID != 0 {
+		b.where("feed_id = ?", filters.FeedID)
+	}
+	if !filters.From.IsZero() {
+		b.where("published >= ?", filters.From)
+	}
+	if !filters.To.IsZero() {
+		b.where("published < ?", filters.To)
+	}
+	if filters.HasImage != nil {
+		b.where(presence("image", *filters.HasImage))
+	}
+	if filters.HasDescription != nil {
+		b.where(presence("description", *filters.HasDescription))
+	}
+	if filters.EnrichmentStatus != "" {
+		b.where("enrichment_status = ?", filters.EnrichmentStatus)
+	}
+	if filters.MinAttempts > 0 {
+		b.where("enrichment_attempts >= ?", filters.MinAttempts)
+	}
+	if filters.ClusterID != 0 {
+		b.where("COALESCE(story_cluster_id, id) = ?", filters.ClusterID)
+	}
+
+	// collapsed listing has the latest of the filtered items of every story cluster, the rest are counted
+	// as related. Filters apply to the inner query, the page boundary to the outer one
+	from, related := "news", "0"
+	if filters.Collapse {
+		from = `(SELECT *, row_number() OVER (story ORDER BY published DESC, id DESC) AS story_row,
+				count(*) OVER story - 1 AS related
+			FROM news
+			` + b.whereSQL() + `
+			WINDOW story AS (PARTITION BY COALESCE(story_cluster_id, id))
+		) AS news`
+		related = "related"
+		b.conds = []string{"story_row = 1"}
+	}
+
+	// keyset of the listing order
+	sort := filters.sortOrder()
+	keys := []string{"published", "id"}
+	if sort == SortRelevance {
+		keys = append([]string{rank}, keys...)
+	}
+
+	// the page before the cursor is fetched in reverse order
+	c := filters.Cursor
+	asc := sort == SortPublishedAsc
+	if c.Backward {
+		asc = !asc
+	}
+	dir, cmp := "DESC", "<"
+	if asc {
+		dir, cmp = "ASC", ">"
+	}
+
+	if !c.IsZero() {
+		values := []string{}
+		if sort == SortRelevance {
+			values = append(values, b.arg(c.Rank)+"::real")
+		}
+		values = append(values, b.arg(c.Published), b.arg(c.ID))
+		b.where("(" + strings.Join(keys, ", ") + ") " + cmp + " (" + strings.Join(values, ", ") + ")")
+	}
+
+	// one more item tells if there are items past the page
+	limit := b.arg(filters.limit() + 1)
+
 	rows, err := s.db.QueryContext(ctx,
-		`SELECT count(*) OVER(), id, title, link, published, description, image 
-		FROM news
-		ORDER BY published DESC
-		LIMIT $1 OFFSET $2
-		`, filters.limit(), filters.offset())
+		`SELECT `+newsColumns+`, `+snippet+`, `+rank+`, `+related+`
+		FROM `+from+`
+		`+b.whereSQL()+`
+		ORDER BY `+strings.Join(keys, " "+dir+", ")+" "+dir+`
+		LIMIT `+limit,
+		b.args...)
 	if err != nil {
 		return nil, Metadata{}, err
 	}
@@ -125,51 +629,443 @@ func (s *Storage) GetNews(ctx context.Context, filters Filters) ([]NewsItem, Met
 		}
 	}()
 
-	totalRecords := 0
-	items := []NewsItem{}
+	items, ranks := []NewsItem{}, []float64{}
 	for rows.Next() {
-		item := NewsItem{}
-		err = rows.Scan(
-			&totalRecords,
-			&item.ID,
-			&item.Title,
-			&item.Link,
-			&item.Published,
-			&item.Description,
-			&item.Image,
-		)
+		item, rank := NewsItem{}, 0.0
+		err = scanNewsItem(rows, &item, &item.Snippet, &rank, &item.Related)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
 		items = append(items, item)
+		ranks = append(ranks, rank)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, Metadata{}, err
 	}
 
-	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	more := len(items) > filters.limit()
+	if more {
+		items, ranks = items[:filters.limit()], ranks[:filters.limit()]
+	}
+	if c.Backward {
+		slices.Reverse(items)
+		slices.Reverse(ranks)
+	}
 
-	return items, metadata, nil
+	return items, pageMetadata(items, ranks, filters, more), nil
 }
 
-// GetNewsItem returns news item by Link
+// GetSingleNews returns news item by ID
 func (s *Storage) GetSingleNews(ctx context.Context, id int) (*NewsItem, error) {
+	defer observeQuery("get_single_news")()
+
 	item := NewsItem{}
-	err := s.db.QueryRowContext(ctx,
-		`SELECT id, title, link, published, description, image FROM news WHERE id = $1`,
-		id).Scan(
+	err := scanNewsItem(s.db.QueryRowContext(ctx,
+		`SELECT `+newsColumns+`,
+			(SELECT count(*) FROM news_revisions WHERE news_id = news.id)
+		FROM news WHERE id = $1`,
+		id), &item, &item.Revisions)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &item, nil
+}
+
+// newsColumns are the columns of news table in the order scanNewsItem expects them
+const newsColumns = `id, title, link, published, description, image, COALESCE(feed_id, 0),
+	body, authors, section, tags, canonical_url, article_published, article_modified, meta, publisher,
+	enrichment_status, enrichment_attempts, enriched_at, last_error, COALESCE(story_cluster_id, id),
+	COALESCE(canonical_link, ''), COALESCE(article_link, '')`
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanNewsItem scans newsColumns into the news item, extra destinations
+// are scanned from the columns following newsColumns
+func scanNewsItem(row rowScanner, item *NewsItem, extra ...any) error {
+	var published, modified, enriched sql.NullTime
+	var meta []byte
+
+	dest := []any{
 		&item.ID,
 		&item.Title,
 		&item.Link,
 		&item.Published,
 		&item.Description,
-		&item.Image)
+		&item.Image,
+		&item.FeedID,
+		&item.Body,
+		pq.Array(&item.Authors),
+		&item.Section,
+		pq.Array(&item.Tags),
+		&item.CanonicalURL,
+		&published,
+		&modified,
+		&meta,
+		&item.Publisher,
+		&item.EnrichmentStatus,
+		&item.EnrichmentAttempts,
+		&enriched,
+		&item.LastError,
+		&item.ClusterID,
+		&item.CanonicalLink,
+		&item.ArticleLink,
+	}
 
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return err
+	}
+
+	item.ArticlePublished = timePtr(published)
+	item.ArticleModified = timePtr(modified)
+	item.EnrichedAt = timePtr(enriched)
+
+	err = json.Unmarshal(meta, &item.Meta)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal meta: %w", err)
+	}
+
+	return nil
+}
+
+// nullTime converts zero time to NULL
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// timePtr returns pointer to the time, nil for NULL
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// CreateFeed saves feed subscription to DB, existing feed (by URL) is left intact.
+// ID and stored values of the feed are loaded into given item
+func (s *Storage) CreateFeed(ctx context.Context, feed *Feed) error {
+	defer observeQuery("create_feed")()
+
+	if feed == nil || feed.URL == "" {
+		return errors.New("feed is empty")
+	}
+
+	return s.db.QueryRowContext(ctx,
+		`WITH ins AS (
+			INSERT INTO feeds (url, title, ttl, enabled)
+			VALUES ($1, $2, make_interval(secs => $3), $4)
+			ON CONFLICT (url) DO NOTHING
+			RETURNING id, title, EXTRACT(EPOCH FROM ttl)::bigint, enabled, etag, last_modified
+		)
+		SELECT * FROM ins
+		UNION ALL
+		SELECT id, title, EXTRACT(EPOCH FROM ttl)::bigint, enabled, etag, last_modified FROM feeds WHERE url = $1
+		LIMIT 1`,
+		feed.URL, feed.Title, feed.TTL.Seconds(), feed.Enabled).Scan(
+		&feed.ID,
+		&feed.Title,
+		(*seconds)(&feed.TTL),
+		&feed.Enabled,
+		&feed.ETag,
+		&feed.LastModified)
+}
+
+// GetFeeds returns all enabled feeds
+func (s *Storage) GetFeeds(ctx context.Context) ([]Feed, error) {
+	defer observeQuery("get_feeds")()
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, url, title, EXTRACT(EPOCH FROM ttl)::bigint, enabled, etag, last_modified
+		FROM feeds
+		WHERE enabled
+		ORDER BY id`)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, ErrNotFound
-		}
 		return nil, err
 	}
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Printf("failed to close rows: %v", err)
+		}
+	}()
 
-	return &item, nil
+	feeds := []Feed{}
+	for rows.Next() {
+		feed := Feed{}
+		err = rows.Scan(
+			&feed.ID,
+			&feed.URL,
+			&feed.Title,
+			(*seconds)(&feed.TTL),
+			&feed.Enabled,
+			&feed.ETag,
+			&feed.LastModified,
+		)
+		if err != nil {
+			return nil, err
+		}
+		feeds = append(feeds, feed)
+	}
+
+	return feeds, rows.Err()
+}
+
+// SaveFeedValidators stores ETag and Last-Modified values of the last fetched feed version
+func (s *Storage) SaveFeedValidators(ctx context.Context, feed *Feed) error {
+	defer observeQuery("save_feed_validators")()
+
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE feeds SET etag = $1, last_modified = $2 WHERE id = $3`,
+		feed.ETag,
+		feed.LastModified,
+		feed.ID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return err
+}
+
+// outboxClaimTimeout is the time after which outbox messages claimed by a relay and not marked
+// sent (relay crashed) are claimed again
+const outboxClaimTimeout = 5 * time.Minute
+
+// RelayOutbox publishes up to limit pending outbox messages in order and marks them sent,
+// returns number of messages sent. Messages are claimed before publishing, so concurrent relays
+// skip them, and published with no transaction open. Relaying stops at the first publish error,
+// the rest is released to stay pending. Message may be published more than once if marking fails
+// after publish or the relay crashes in between
+func (s *Storage) RelayOutbox(ctx context.Context, limit int, publish func(payload []byte) error) (int, error) {
+	defer observeQuery("relay_outbox")()
+
+	rows, err := s.db.QueryContext(ctx,
+		`UPDATE outbox SET claimed_until = now() + $2 * interval '1 millisecond'
+		WHERE id IN (
+			SELECT id FROM outbox
+			WHERE sent_at IS NULL AND (claimed_until IS NULL OR claimed_until < now())
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, payload`,
+		limit, outboxClaimTimeout.Milliseconds())
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim outbox: %w", err)
+	}
+
+	type message struct {
+		id      int64
+		payload string
+	}
+	pending := []message{}
+	for rows.Next() {
+		msg := message{}
+		if err := rows.Scan(&msg.id, &msg.payload); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan outbox: %w", err)
+		}
+		pending = append(pending, msg)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read outbox: %w", err)
+	}
+	// RETURNING doesn't keep the order of the subquery
+	slices.SortFunc(pending, func(a, b message) int { return cmp.Compare(a.id, b.id) })
+
+	sent, unsent := []int64{}, []int64{}
+	var publishErr error
+	for i, msg := range pending {
+		if publishErr = publish([]byte(msg.payload)); publishErr != nil {
+			for _, msg := range pending[i:] {
+				unsent = append(unsent, msg.id)
+			}
+			break
+		}
+		sent = append(sent, msg.id)
+	}
+
+	if len(sent) > 0 {
+		_, err = s.db.ExecContext(ctx, `UPDATE outbox SET sent_at = now(), claimed_until = NULL WHERE id = ANY($1)`, pq.Array(sent))
+		if err != nil {
+			return 0, fmt.Errorf("failed to mark outbox sent: %w", err)
+		}
+	}
+
+	if publishErr != nil {
+		_, err = s.db.ExecContext(ctx, `UPDATE outbox SET claimed_until = NULL WHERE id = ANY($1)`, pq.Array(unsent))
+		if err != nil {
+			log.Printf("[WARN] failed to release outbox messages, they are relayed after the claim timeout: %v", err)
+		}
+		return len(sent), fmt.Errorf("failed to publish outbox message: %w", publishErr)
+	}
+
+	return len(sent), nil
+}
+
+// RequeueNews writes enrichment messages of news items matching the filter to the outbox,
+// most incomplete items first: missing description or image, never or least recently enriched,
+// then the latest. Messages have re-enrichment priority. Returns the number of re-queued items
+func (s *Storage) RequeueNews(ctx context.Context, f ReenrichFilter) (int, error) {
+	defer observeQuery("requeue_news")()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck // no-op after commit
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT id, link, COALESCE(feed_id, 0) FROM news
+		WHERE (id = $1 OR $1 = 0)
+		AND (published >= $2 OR $2 IS NULL)
+		AND (published < $3 OR $3 IS NULL)
+		AND (description = '' OR image = '' OR enriched_at IS NULL OR enriched_at < $4 OR $4 IS NULL)
+		AND (enrich_requested_at < $5 OR $5 IS NULL)
+		ORDER BY (description = '' OR image = '') DESC, enriched_at ASC NULLS FIRST, published DESC
+		LIMIT NULLIF($6, 0)
+		FOR UPDATE SKIP LOCKED`,
+		f.ID, nullTime(f.From), nullTime(f.To), nullTime(f.EnrichedBefore), nullTime(f.RequestedBefore), f.Limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get news to re-enrich: %w", err)
+	}
+
+	items := []NewsItem{}
+	for rows.Next() {
+		item := NewsItem{}
+		if err := rows.Scan(&item.ID, &item.Link, &item.FeedID); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan news: %w", err)
+		}
+		items = append(items, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read news: %w", err)
+	}
+	if len(items) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]int64, 0, len(items))
+	for _, item := range items {
+		msg := NewEnrichMessage(&item)
+		msg.Priority = PriorityReenrich
+		payload, err := msg.Encode()
+		if err != nil {
+			return 0, fmt.Errorf("failed to encode enrichment message: %w", err)
+		}
+		_, err = tx.ExecContext(ctx, `INSERT INTO outbox (payload) VALUES ($1)`, payload)
+		if err != nil {
+			return 0, fmt.Errorf("failed to write outbox: %w", err)
+		}
+		ids = append(ids, int64(item.ID))
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE news SET enrich_requested_at = now() WHERE id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark news requested: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit re-enrichment: %w", err)
+	}
+
+	return len(items), nil
+}
+
+// PruneOutbox deletes messages sent before given time, returns number of deleted rows
+func (s *Storage) PruneOutbox(ctx context.Context, before time.Time) (int64, error) {
+	defer observeQuery("prune_outbox")()
+
+	res, err := s.db.ExecContext(ctx, `DELETE FROM outbox WHERE sent_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune outbox: %w", err)
+	}
+
+	return res.RowsAffected()
+}
+
+// CanonicalizeLinks sets canonical links of news saved without them, by batches of given size.
+// Items with the canonical link of another item are duplicates, they are left without it.
+// Returns number of updated items
+func (s *Storage) CanonicalizeLinks(ctx context.Context, batch int) (int, error) {
+	defer observeQuery("canonicalize_links")()
+
+	total, last := 0, 0
+	for {
+		rows, err := s.db.QueryContext(ctx,
+			`SELECT id, link FROM news WHERE canonical_link IS NULL AND id > $1 ORDER BY id LIMIT $2`,
+			last, batch)
+		if err != nil {
+			return total, fmt.Errorf("failed to get news without canonical links: %w", err)
+		}
+		ids, links := []int64{}, []string{}
+		for rows.Next() {
+			var id int64
+			var link string
+			if err := rows.Scan(&id, &link); err != nil {
+				rows.Close()
+				return total, fmt.Errorf("failed to scan news link: %w", err)
+			}
+			ids = append(ids, id)
+			links = append(links, canonicalLink(link))
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return total, fmt.Errorf("failed to read news links: %w", err)
+		}
+		if len(ids) == 0 {
+			return total, nil
+		}
+
+		// the earliest of the batch items with the same canonical link gets it
+		res, err := s.db.ExecContext(ctx,
+			`UPDATE news SET canonical_link = t.canonical_link
+			FROM (
+				SELECT DISTINCT ON (canonical_link) id, canonical_link
+				FROM unnest($1::int[], $2::text[]) AS t(id, canonical_link)
+				ORDER BY canonical_link, id
+			) AS t
+			WHERE news.id = t.id
+				AND NOT EXISTS (SELECT 1 FROM news AS other WHERE other.canonical_link = t.canonical_link)`,
+			pq.Array(ids), pq.Array(links))
+		if err != nil {
+			return total, fmt.Errorf("failed to save canonical links: %w", err)
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += int(affected)
+		last = int(ids[len(ids)-1])
+	}
+}
+
+// seconds scans whole number of seconds into time.Duration
+type seconds time.Duration
+
+// Scan implements sql.Scanner
+func (d *seconds) Scan(src any) error {
+	n, ok := src.(int64)
+	if !ok {
+		return fmt.Errorf("unexpected type for seconds: %T", src)
+	}
+	*d = seconds(time.Duration(n) * time.Second)
+	return nil
 }
 
 // Close closes DB connection
@@ -177,6 +1073,11 @@ func (s *Storage) Close() error {
 	return s.db.Close()
 }
 
+// Ping checks that DB connection is alive
+func (s *Storage) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
 // openDB opens connection to PostgreSQL DB, pings it and returns connection
 func openDB(cfg DBConfig) (*sql.DB, error) {
 	db, err := sql.Open("postgres", cfg.Dsn)
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"testing"
@@ -207,31 +208,537 @@ func TestStorage(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Test GetNews
-	items, meta, err := store.GetNews(ctx, Filters{Page: 1, PageSize: 10})
+	items, meta, err := store.GetNews(ctx, Filters{PageSize: 10})
 	assert.NoError(t, err)
-	assert.Len(t, items, 2)
-	assert.Equal(t, 2, meta.TotalRecords) // 2 items in the database now
-	assert.Equal(t, 1, meta.CurrentPage)
+	assert.Len(t, items, 2) // 2 items in the database now
+	assert.Equal(t, Metadata{PageSize: 10}, meta)
 
-	// Test GetNews with pagination
-	// page 1 (1 item)
-	items, meta, err = store.GetNews(ctx, Filters{Page: 1, PageSize: 1})
+	// Test GetNews with cursor pagination
+	// page 1 (1 item), the latest first
+	items, meta, err = store.GetNews(ctx, Filters{PageSize: 1})
 	assert.NoError(t, err)
 	assert.Len(t, items, 1)
-	assert.Equal(t, 2, meta.TotalRecords)
-	assert.Equal(t, 1, meta.CurrentPage)
+	assert.Equal(t, anotherItem.ID, items[0].ID)
+	assert.NotEmpty(t, meta.Next)
+	assert.Empty(t, meta.Prev)
 
 	// page 2 (1 item)
-	items, meta, err = store.GetNews(ctx, Filters{Page: 2, PageSize: 1})
+	cursor, err := DecodeCursor(meta.Next)
+	assert.NoError(t, err)
+	items, meta, err = store.GetNews(ctx, Filters{PageSize: 1, Cursor: cursor})
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+	assert.Equal(t, validItem.ID, items[0].ID)
+	assert.Empty(t, meta.Next)
+	assert.NotEmpty(t, meta.Prev)
+
+	// back to page 1, new item doesn't shift the pages
+	// added directly, not to leave the message in the outbox
+	newerID := 0
+	err = store.db.QueryRowContext(ctx,
+		`INSERT INTO news (title, link, published) VALUES ('newer title', 'newer_link', now()) RETURNING id`).Scan(&newerID)
+	assert.NoError(t, err)
+
+	cursor, err = DecodeCursor(meta.Prev)
+	assert.NoError(t, err)
+	items, meta, err = store.GetNews(ctx, Filters{PageSize: 1, Cursor: cursor})
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+	assert.Equal(t, anotherItem.ID, items[0].ID)
+	assert.NotEmpty(t, meta.Next)
+	assert.NotEmpty(t, meta.Prev)
+
+	// past the last page (0 items)
+	items, meta, err = store.GetNews(ctx, Filters{PageSize: 1, Cursor: Cursor{Published: validItem.Published, ID: validItem.ID}})
+	assert.NoError(t, err)
+	assert.Len(t, items, 0)
+	assert.Equal(t, Metadata{PageSize: 1}, meta)
+
+	_, err = store.db.ExecContext(ctx, `DELETE FROM news WHERE id = $1`, newerID)
+	assert.NoError(t, err)
+
+	// Test CreateFeed
+
+	// empty feed
+	err = store.CreateFeed(ctx, &Feed{})
+	assert.Error(t, err)
+
+	feed := Feed{URL: "feed_url", TTL: 5 * time.Minute, Enabled: true}
+	err = store.CreateFeed(ctx, &feed)
+	assert.NoError(t, err)
+	assert.NotZero(t, feed.ID)
+
+	// existing feed is not overwritten, stored values are returned
+	sameFeed := Feed{URL: "feed_url", TTL: time.Hour, Enabled: true}
+	err = store.CreateFeed(ctx, &sameFeed)
+	assert.NoError(t, err)
+	assert.Equal(t, feed.ID, sameFeed.ID)
+	assert.Equal(t, 5*time.Minute, sameFeed.TTL)
+
+	disabledFeed := Feed{URL: "disabled_feed_url", TTL: time.Minute, Enabled: false}
+	err = store.CreateFeed(ctx, &disabledFeed)
+	assert.NoError(t, err)
+
+	// Test SaveFeedValidators
+	feed.ETag = `"etag"`
+	feed.LastModified = "Wed, 21 Oct 2015 07:28:00 GMT"
+	err = store.SaveFeedValidators(ctx, &feed)
+	assert.NoError(t, err)
+
+	err = store.SaveFeedValidators(ctx, &Feed{ID: 0})
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Test GetFeeds, only enabled feeds are returned, with stored validators
+	feeds, err := store.GetFeeds(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []Feed{feed}, feeds)
+
+	// Test GetNews filtered by feed
+	feedItem := NewsItem{
+		Title:     "feed_title",
+		Link:      "feed_link",
+		Published: time.Now(),
+		FeedID:    feed.ID,
+	}
+	err = store.CreateNewsItem(ctx, &feedItem)
+	assert.NoError(t, err)
+
+	items, _, err = store.GetNews(ctx, Filters{PageSize: 10, FeedID: feed.ID})
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+	assert.Equal(t, feedItem.ID, items[0].ID)
+	assert.Equal(t, feed.ID, items[0].FeedID)
+
+	// all feeds
+	items, _, err = store.GetNews(ctx, Filters{PageSize: 10})
+	assert.NoError(t, err)
+	assert.Len(t, items, 3)
+
+	// Test GetNews with full-text search
+	searchItem := NewsItem{
+		Title:     "Elections in France",
+		Link:      "search_link",
+		Published: time.Now().Add(-time.Hour),
+	}
+	err = store.CreateNewsItem(ctx, &searchItem)
+	assert.NoError(t, err)
+	searchItem.Description = "Voters went to the polls to elect a new parliament"
+	err = store.SaveNewsItem(ctx, &searchItem)
+	assert.NoError(t, err)
+
+	// stemmed match in title and description
+	items, _, err = store.GetNews(ctx, Filters{PageSize: 10, Query: "election polls"})
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+	assert.Equal(t, searchItem.ID, items[0].ID)
+	assert.Contains(t, items[0].Snippet, "<mark>polls</mark>")
+
+	// title match is ranked higher than description match
+	rankedItem := NewsItem{
+		Title:     "Parliament approves budget",
+		Link:      "ranked_link",
+		Published: time.Now().Add(-2 * time.Hour),
+	}
+	err = store.CreateNewsItem(ctx, &rankedItem)
+	assert.NoError(t, err)
+
+	items, _, err = store.GetNews(ctx, Filters{PageSize: 10, Query: "parliament"})
+	assert.NoError(t, err)
+	assert.Len(t, items, 2)
+	assert.Equal(t, rankedItem.ID, items[0].ID)
+	assert.Equal(t, searchItem.ID, items[1].ID)
+
+	// search results are paginated in rank order
+	items, meta, err = store.GetNews(ctx, Filters{PageSize: 1, Query: "parliament"})
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+	assert.Equal(t, rankedItem.ID, items[0].ID)
+
+	cursor, err = DecodeCursor(meta.Next)
+	assert.NoError(t, err)
+	assert.NotZero(t, cursor.Rank)
+	items, meta, err = store.GetNews(ctx, Filters{PageSize: 1, Query: "parliament", Cursor: cursor})
 	assert.NoError(t, err)
 	assert.Len(t, items, 1)
-	assert.Equal(t, 2, meta.TotalRecords)
-	assert.Equal(t, 2, meta.CurrentPage)
+	assert.Equal(t, searchItem.ID, items[0].ID)
+	assert.Empty(t, meta.Next)
 
-	// page 3 (0 items)
-	items, meta, err = store.GetNews(ctx, Filters{Page: 3, PageSize: 1})
+	// no match
+	items, _, err = store.GetNews(ctx, Filters{PageSize: 10, Query: "nothing like this"})
 	assert.NoError(t, err)
 	assert.Len(t, items, 0)
-	assert.Equal(t, 0, meta.TotalRecords) // rows.Next() returned false
-	assert.Equal(t, 0, meta.CurrentPage)
+
+	// snippets are empty without search query
+	items, _, err = store.GetNews(ctx, Filters{PageSize: 10})
+	assert.NoError(t, err)
+	for _, item := range items {
+		assert.Empty(t, item.Snippet)
+	}
+
+	// Test GetNews with presence filters and sort order
+	yes, no := true, false
+	items, _, err = store.GetNews(ctx, Filters{PageSize: 10, HasDescription: &yes})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, items)
+	for _, item := range items {
+		assert.NotEmpty(t, item.Description)
+	}
+	items, _, err = store.GetNews(ctx, Filters{PageSize: 10, HasImage: &no})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, items)
+	for _, item := range items {
+		assert.Empty(t, item.Image)
+	}
+
+	items, _, err = store.GetNews(ctx, Filters{PageSize: 10, Query: "parliament", Sort: SortPublishedAsc})
+	assert.NoError(t, err)
+	assert.Len(t, items, 2)
+	assert.Equal(t, rankedItem.ID, items[0].ID) // published earlier, ranked higher by relevance
+	assert.Equal(t, searchItem.ID, items[1].ID)
+	items, meta, err = store.GetNews(ctx, Filters{PageSize: 1, Sort: SortPublishedAsc})
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+	cursor, err = DecodeCursor(meta.Next)
+	assert.NoError(t, err)
+	assert.Equal(t, SortPublishedAsc, cursor.Sort)
+	next, _, err := store.GetNews(ctx, Filters{PageSize: 1, Sort: SortPublishedAsc, Cursor: cursor})
+	assert.NoError(t, err)
+	assert.Len(t, next, 1)
+	assert.False(t, next[0].Published.Before(items[0].Published))
+
+	// Test SaveNewsItem with article data
+	published := time.Date(2024, 7, 1, 10, 0, 0, 0, time.UTC)
+	searchItem.Body = "First paragraph\n\nSecond paragraph"
+	searchItem.Authors = []string{"John Doe", "Jane Roe"}
+	searchItem.Section = "World"
+	searchItem.Tags = []string{"Politics", "Europe"}
+	searchItem.CanonicalURL = "canonical_link"
+	searchItem.Publisher = "BBC News"
+	searchItem.ArticlePublished = &published
+	searchItem.Meta = map[string]string{"og:type": "article", "twitter:card": "summary"}
+	err = store.SaveNewsItem(ctx, &searchItem)
+	assert.NoError(t, err)
+
+	retrieved, err = store.GetSingleNews(ctx, searchItem.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, searchItem.Body, retrieved.Body)
+	assert.Equal(t, searchItem.Authors, retrieved.Authors)
+	assert.Equal(t, searchItem.Section, retrieved.Section)
+	assert.Equal(t, searchItem.Tags, retrieved.Tags)
+	assert.Equal(t, searchItem.CanonicalURL, retrieved.CanonicalURL)
+	assert.Equal(t, searchItem.Publisher, retrieved.Publisher)
+	assert.True(t, published.Equal(*retrieved.ArticlePublished))
+	assert.Nil(t, retrieved.ArticleModified) // NULL in DB
+	assert.Equal(t, searchItem.Meta, retrieved.Meta)
+
+	// Test RelayOutbox, messages of created items are published in order
+	relayed := []string{}
+	publish := func(payload []byte) error {
+		msg, err := DecodeEnrichMessage(payload)
+		assert.NoError(t, err)
+		assert.NotZero(t, msg.NewsID)
+		assert.NotEmpty(t, msg.CorrelationID)
+		relayed = append(relayed, msg.Link)
+		return nil
+	}
+	sent, err := store.RelayOutbox(ctx, 2, publish)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, sent)
+	assert.Equal(t, []string{"link", "another_link"}, relayed)
+
+	// failed publish leaves messages pending
+	sent, err = store.RelayOutbox(ctx, 10, func([]byte) error { return errors.New("broker is down") })
+	assert.Error(t, err)
+	assert.Equal(t, 0, sent)
+
+	sent, err = store.RelayOutbox(ctx, 10, publish)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, sent)
+	assert.Equal(t, []string{"link", "another_link", "feed_link", "search_link", "ranked_link"}, relayed)
+
+	sent, err = store.RelayOutbox(ctx, 10, publish)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, sent)
+
+	// Test PruneOutbox
+	deleted, err := store.PruneOutbox(ctx, time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Zero(t, deleted)
+
+	deleted, err = store.PruneOutbox(ctx, time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), deleted)
+
+	// Test SaveEnrichmentResult
+	err = store.SaveEnrichmentResult(ctx, validItem.ID, errors.New("page not found"))
+	assert.NoError(t, err)
+	err = store.SaveEnrichmentResult(ctx, searchItem.ID, nil)
+	assert.NoError(t, err)
+
+	items, _, err = store.GetNews(ctx, Filters{PageSize: 10, EnrichmentStatus: EnrichmentFailed})
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+	assert.Equal(t, validItem.ID, items[0].ID)
+	assert.Equal(t, 1, items[0].EnrichmentAttempts)
+	assert.Equal(t, "page not found", items[0].LastError)
+	assert.Nil(t, items[0].EnrichedAt)
+
+	// retry succeeded
+	err = store.SaveEnrichmentResult(ctx, validItem.ID, nil)
+	assert.NoError(t, err)
+
+	items, _, err = store.GetNews(ctx, Filters{PageSize: 10, EnrichmentStatus: EnrichmentSuccess, MinAttempts: 2})
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+	assert.Equal(t, validItem.ID, items[0].ID)
+	assert.Equal(t, EnrichmentSuccess, items[0].EnrichmentStatus)
+	assert.Empty(t, items[0].LastError)
+	assert.NotNil(t, items[0].EnrichedAt)
+
+	items, _, err = store.GetNews(ctx, Filters{PageSize: 10, EnrichmentStatus: EnrichmentPending})
+	assert.NoError(t, err)
+	assert.Len(t, items, 3)
+
+	err = store.SaveEnrichmentResult(ctx, 100500, nil)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Test RequeueNews, single item
+	queued, err := store.RequeueNews(ctx, ReenrichFilter{ID: rankedItem.ID})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, queued)
+
+	queued, err = store.RequeueNews(ctx, ReenrichFilter{ID: 100500})
+	assert.NoError(t, err)
+	assert.Zero(t, queued)
+
+	relayed = []string{}
+	sent, err = store.RelayOutbox(ctx, 10, publish)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	assert.Equal(t, []string{"ranked_link"}, relayed)
+
+	// never enriched items go first, the latest of them
+	queued, err = store.RequeueNews(ctx, ReenrichFilter{
+		EnrichedBefore:  time.Now(),
+		RequestedBefore: time.Now().Add(time.Minute),
+		Limit:           2,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, queued)
+
+	relayed = []string{}
+	_, err = store.RelayOutbox(ctx, 10, publish)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"feed_link", "another_link"}, relayed)
+
+	// items requested recently are skipped
+	queued, err = store.RequeueNews(ctx, ReenrichFilter{
+		EnrichedBefore:  time.Now(),
+		RequestedBefore: time.Now().Add(-time.Minute),
+	})
+	assert.NoError(t, err)
+	assert.Zero(t, queued)
+
+	// Test UpsertNewsItems, new, unchanged, edited, repeated and invalid items
+	batch := []NewsItem{
+		{Title: "Upserted news", Link: "upsert_link", Published: time.Now(), FeedID: feed.ID},
+		{Title: rankedItem.Title, Link: rankedItem.Link, Published: rankedItem.Published},
+		{Title: "Parliament rejects budget", Link: rankedItem.Link, Published: rankedItem.Published},
+		{Title: "Upserted news again", Link: "upsert_link"},
+		{Title: "", Link: "no_title_link"},
+	}
+	res, err := store.UpsertNewsItems(ctx, batch)
+	assert.NoError(t, err)
+	assert.Len(t, res.Inserted, 1)
+	assert.Empty(t, res.Updated)
+	assert.Equal(t, 3, res.Skipped)
+	assert.Equal(t, 1, res.Invalid)
+	assert.Equal(t, res.Inserted[0], batch[0].ID)
+	assert.Equal(t, rankedItem.ID, batch[1].ID)
+
+	// new item is written to the outbox
+	relayed = []string{}
+	_, err = store.RelayOutbox(ctx, 10, publish)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"upsert_link"}, relayed)
+
+	// edited headline is updated, the previous one is kept as revision
+	editedItem := NewsItem{Title: "Parliament rejects budget", Link: rankedItem.Link, Published: rankedItem.Published}
+	res, err = store.UpsertNewsItems(ctx, []NewsItem{editedItem, batch[0]})
+	assert.NoError(t, err)
+	assert.Empty(t, res.Inserted)
+	assert.Equal(t, []int{rankedItem.ID}, res.Updated)
+	assert.Equal(t, 1, res.Skipped)
+
+	relayed = []string{}
+	sent, err = store.RelayOutbox(ctx, 10, publish)
+	assert.NoError(t, err)
+	assert.Zero(t, sent)
+
+	revisions, err := store.GetRevisions(ctx, rankedItem.ID)
+	assert.NoError(t, err)
+	assert.Len(t, revisions, 1)
+	assert.Equal(t, rankedItem.Title, revisions[0].Title)
+	assert.WithinDuration(t, rankedItem.Published, revisions[0].Published, time.Millisecond)
+
+	retrieved, err = store.GetSingleNews(ctx, rankedItem.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, editedItem.Title, retrieved.Title)
+	assert.Equal(t, 1, retrieved.Revisions)
+
+	// Test story clusters, the same story of another source joins the cluster of the first one
+	published = time.Now().Add(-30 * time.Minute)
+	story := []NewsItem{
+		{Title: "Fire breaks out at Notre-Dame cathedral in Paris", Link: "story_link_1", Published: published},
+		{Title: "Fire breaks out in Notre-Dame cathedral, Paris", Link: "story_link_2", Published: published.Add(time.Minute)},
+	}
+	res, err = store.UpsertNewsItems(ctx, story)
+	assert.NoError(t, err)
+	assert.Len(t, res.Inserted, 2)
+
+	lateItem := NewsItem{Title: "Notre-Dame cathedral in Paris: fire breaks out", Link: "story_link_3", Published: published.Add(time.Hour)}
+	err = store.CreateNewsItem(ctx, &lateItem)
+	assert.NoError(t, err)
+
+	items, _, err = store.GetNews(ctx, Filters{PageSize: 10, ClusterID: story[0].ID})
+	assert.NoError(t, err)
+	assert.Len(t, items, 3)
+	for _, item := range items {
+		assert.Equal(t, story[0].ID, item.ClusterID)
+		assert.Zero(t, item.Related)
+	}
+
+	// collapsed listing has the latest item of the story with the number of the others
+	items, _, err = store.GetNews(ctx, Filters{PageSize: 100, Collapse: true})
+	assert.NoError(t, err)
+	clustered := 0
+	for _, item := range items {
+		if item.ClusterID != story[0].ID {
+			assert.Zero(t, item.Related)
+			continue
+		}
+		clustered++
+		assert.Equal(t, lateItem.ID, item.ID)
+		assert.Equal(t, 2, item.Related)
+	}
+	assert.Equal(t, 1, clustered)
+
+	// unrelated description moves the item to its own cluster
+	lateItem.Description = "Scientists announce a breakthrough in battery chemistry, promising cheaper electric cars"
+	err = store.SaveNewsItem(ctx, &lateItem)
+	assert.NoError(t, err)
+	retrieved, err = store.GetSingleNews(ctx, lateItem.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, lateItem.ID, retrieved.ClusterID)
+
+	// the rest of the cluster is renamed when the item it's named after leaves
+	story[0].Description = "Central bank raises interest rates again to curb inflation across the eurozone economy"
+	err = store.SaveNewsItem(ctx, &story[0])
+	assert.NoError(t, err)
+	for _, item := range story {
+		retrieved, err = store.GetSingleNews(ctx, item.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, item.ID, retrieved.ClusterID)
+	}
+
+	// Test link canonicalization, links differing in tracking parameters are the same article
+	trackedItem := NewsItem{
+		Title:     "Tracked news",
+		Link:      "https://www.BBC.com/news/articles/c1?at_medium=RSS&at_campaign=rss#comments",
+		Published: time.Now(),
+	}
+	err = store.CreateNewsItem(ctx, &trackedItem)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://www.bbc.com/news/articles/c1", trackedItem.CanonicalLink)
+
+	err = store.CreateNewsItem(ctx, &NewsItem{Title: "Tracked news", Link: "http://www.bbc.com/news/articles/c1?utm_source=x", Published: time.Now()})
+	assert.ErrorIs(t, err, ErrAlreadyExists)
+
+	res, err = store.UpsertNewsItems(ctx, []NewsItem{
+		{Title: "Tracked news", Link: "https://www.bbc.com/news/articles/c1?at_medium=email", Published: trackedItem.Published},
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, res.Inserted)
+	assert.Empty(t, res.Updated)
+	assert.Equal(t, 1, res.Skipped)
+
+	// canonical link of the article page is saved as article link, the feed link stays the dedup key
+	trackedItem.CanonicalURL = "/news/articles/c1-story"
+	err = store.SaveNewsItem(ctx, &trackedItem)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://www.bbc.com/news/articles/c1", trackedItem.CanonicalLink)
+	assert.Equal(t, "https://www.bbc.com/news/articles/c1-story", trackedItem.ArticleLink)
+
+	// the original link and the article page link are the same item
+	res, err = store.UpsertNewsItems(ctx, []NewsItem{
+		{Title: "Tracked news", Link: trackedItem.Link, Published: trackedItem.Published},
+		{Title: "Tracked news", Link: "https://www.bbc.com/news/articles/c1-story?at_medium=RSS", Published: trackedItem.Published},
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, res.Inserted)
+	assert.Equal(t, 2, res.Skipped)
+
+	// so is another tracking variant of the feed link
+	variant := []NewsItem{
+		{Title: "Tracked news", Link: "https://www.bbc.com/news/articles/c1?at_medium=push&at_campaign=app", Published: trackedItem.Published},
+	}
+	res, err = store.UpsertNewsItems(ctx, variant)
+	assert.NoError(t, err)
+	assert.Empty(t, res.Inserted)
+	assert.Equal(t, 1, res.Skipped)
+	assert.Equal(t, trackedItem.ID, variant[0].ID)
+	for _, item := range []string{"https://www.bbc.com/news/articles/c1?at_medium=push", "https://www.bbc.com/news/articles/c1-story?utm_source=x"} {
+		dbItem, err = store.GetNewsItem(ctx, item)
+		assert.NoError(t, err)
+		assert.Equal(t, trackedItem.ID, dbItem.ID)
+		assert.Equal(t, trackedItem.Link, dbItem.Link)
+	}
+
+	// the same article of another feed is a duplicate, it's not updated
+	res, err = store.UpsertNewsItems(ctx, []NewsItem{
+		{Title: "Tracked news of another feed", Link: trackedItem.Link, Published: trackedItem.Published, FeedID: feed.ID},
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, res.Inserted)
+	assert.Empty(t, res.Updated)
+	assert.Equal(t, 1, res.Skipped)
+
+	// item matched by several items of the batch is updated once, by the one with the same canonical link
+	res, err = store.UpsertNewsItems(ctx, []NewsItem{
+		{Title: "Tracked news of the article page", Link: "https://www.bbc.com/news/articles/c1-story", Published: trackedItem.Published},
+		{Title: "Tracked news edited", Link: trackedItem.Link, Published: trackedItem.Published},
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, res.Inserted)
+	assert.Equal(t, []int{trackedItem.ID}, res.Updated)
+	assert.Equal(t, 1, res.Skipped)
+	revisions, err = store.GetRevisions(ctx, trackedItem.ID)
+	assert.NoError(t, err)
+	assert.Len(t, revisions, 1)
+	assert.Equal(t, "Tracked news", revisions[0].Title)
+	retrieved, err = store.GetSingleNews(ctx, trackedItem.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Tracked news edited", retrieved.Title)
+
+	err = store.CreateNewsItem(ctx, &NewsItem{Title: "Tracked news", Link: "https://www.bbc.com/news/articles/c1-story", Published: time.Now()})
+	assert.ErrorIs(t, err, ErrAlreadyExists)
+
+	// article page of another item doesn't change its dedup key
+	otherItem := NewsItem{Title: "Other news", Link: "https://www.bbc.com/news/articles/c2", Published: time.Now()}
+	err = store.CreateNewsItem(ctx, &otherItem)
+	assert.NoError(t, err)
+	otherItem.CanonicalURL = "https://www.bbc.com/news/articles/c1-story"
+	err = store.SaveNewsItem(ctx, &otherItem)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://www.bbc.com/news/articles/c2", otherItem.CanonicalLink)
+
+	// news saved without canonical links get them
+	_, err = store.db.ExecContext(ctx, `UPDATE news SET canonical_link = NULL WHERE id IN ($1, $2)`, trackedItem.ID, otherItem.ID)
+	assert.NoError(t, err)
+	updated, err := store.CanonicalizeLinks(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, updated)
+	dbItem, err = store.GetNewsItem(ctx, trackedItem.Link)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://www.bbc.com/news/articles/c1", dbItem.CanonicalLink)
 }
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+)
+
+// feedInfo describes outgoing feed as a whole
+type feedInfo struct {
+	Title   string
+	Link    string // site URL
+	SelfURL string // URL of the feed itself
+	Updated time.Time
+}
+
+// feedFormat renders news items into outgoing feed of some format
+type feedFormat struct {
+	contentType string
+	render      func(info feedInfo, items []NewsItem) ([]byte, error)
+}
+
+const (
+	rssContentType      = "application/rss+xml; charset=utf-8"
+	atomContentType     = "application/atom+xml; charset=utf-8"
+	jsonFeedContentType = "application/feed+json; charset=utf-8"
+)
+
+var (
+	rssFormat      = feedFormat{contentType: rssContentType, render: renderRSS}
+	atomFormat     = feedFormat{contentType: atomContentType, render: renderAtom}
+	jsonFeedFormat = feedFormat{contentType: jsonFeedContentType, render: renderJSONFeed}
+)
+
+// feedDefaultFilters are used for outgoing feeds, feed readers expect more than a page of items
+var feedDefaultFilters = Filters{
+	PageSize: 50,
+}
+
+// itemURL returns canonical URL of the news item, if known, or its link
+func itemURL(item NewsItem) string {
+	if item.CanonicalURL != "" {
+		return item.CanonicalURL
+	}
+	return item.Link
+}
+
+// itemUpdated returns the last modification time of the news item
+func itemUpdated(item NewsItem) time.Time {
+	if item.ArticleModified != nil && item.ArticleModified.After(item.Published) {
+		return *item.ArticleModified
+	}
+	return item.Published
+}
+
+// lastUpdated returns the latest modification time of the news items, zero time for no items
+func lastUpdated(items []NewsItem) time.Time {
+	updated := time.Time{}
+	for _, item := range items {
+		if t := itemUpdated(item); t.After(updated) {
+			updated = t
+		}
+	}
+	return updated
+}
+
+// imageType guesses MIME type of the image by its URL extension, JPEG is the most common one
+func imageType(link string) string {
+	u, err := url.Parse(link)
+	if err == nil {
+		if t := mime.TypeByExtension(path.Ext(u.Path)); t != "" {
+			return t
+		}
+	}
+	return "image/jpeg"
+}
+
+// RSS 2.0 with Media RSS and Dublin Core extensions
+
+type rssDoc struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	MediaNS string     `xml:"xmlns:media,attr"`
+	DCNS    string     `xml:"xmlns:dc,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	AtomLink      atomLink  `xml:"atom:link"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link"`
+	GUID        string        `xml:"guid"`
+	PubDate     string        `xml:"pubDate"`
+	Description string        `xml:"description,omitempty"`
+	Creators    []string      `xml:"dc:creator"`
+	Categories  []string      `xml:"category"`
+	Enclosure   *rssEnclosure `xml:"enclosure"`
+	Media       *mediaContent `xml:"media:content"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Type   string `xml:"type,attr"`
+	Length int    `xml:"length,attr"` // unknown, 0 is allowed by readers
+}
+
+type mediaContent struct {
+	URL    string `xml:"url,attr"`
+	Type   string `xml:"type,attr"`
+	Medium string `xml:"medium,attr"`
+}
+
+// renderRSS renders news items as RSS 2.0 feed, image goes to enclosure and media:content
+func renderRSS(info feedInfo, items []NewsItem) ([]byte, error) {
+	doc := rssDoc{
+		Version: "2.0",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+		MediaNS: "http://search.yahoo.com/mrss/",
+		DCNS:    "http://purl.org/dc/elements/1.1/",
+		Channel: rssChannel{
+			Title:       info.Title,
+			Link:        info.Link,
+			Description: info.Title,
+			AtomLink:    atomLink{Href: info.SelfURL, Rel: "self", Type: rssContentType},
+		},
+	}
+	if !info.Updated.IsZero() {
+		doc.Channel.LastBuildDate = info.Updated.Format(time.RFC1123Z)
+	}
+
+	for _, item := range items {
+		rss := rssItem{
+			Title:       item.Title,
+			Link:        itemURL(item),
+			GUID:        itemURL(item),
+			PubDate:     item.Published.Format(time.RFC1123Z),
+			Description: item.Description,
+			Creators:    item.Authors,
+			Categories:  item.Tags,
+		}
+		if item.Image != "" {
+			rss.Enclosure = &rssEnclosure{URL: item.Image, Type: imageType(item.Image)}
+			rss.Media = &mediaContent{URL: item.Image, Type: imageType(item.Image), Medium: "image"}
+		}
+		doc.Channel.Items = append(doc.Channel.Items, rss)
+	}
+
+	return marshalXML(doc)
+}
+
+// Atom 1.0
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Updated    string         `xml:"updated"`
+	Published  string         `xml:"published"`
+	Links      []atomLink     `xml:"link"`
+	Summary    string         `xml:"summary,omitempty"`
+	Authors    []atomPerson   `xml:"author"`
+	Categories []atomCategory `xml:"category"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+// renderAtom renders news items as Atom feed, image goes to enclosure link
+func renderAtom(info feedInfo, items []NewsItem) ([]byte, error) {
+	updated := info.Updated
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+
+	feed := atomFeed{
+		Title:   info.Title,
+		ID:      info.SelfURL,
+		Updated: updated.Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: info.Link, Rel: "alternate", Type: "text/html"},
+			{Href: info.SelfURL, Rel: "self", Type: atomContentType},
+		},
+	}
+
+	for _, item := range items {
+		entry := atomEntry{
+			Title:     item.Title,
+			ID:        itemURL(item),
+			Updated:   itemUpdated(item).Format(time.RFC3339),
+			Published: item.Published.Format(time.RFC3339),
+			Links:     []atomLink{{Href: itemURL(item), Rel: "alternate", Type: "text/html"}},
+			Summary:   item.Description,
+		}
+		if item.Image != "" {
+			entry.Links = append(entry.Links, atomLink{Href: item.Image, Rel: "enclosure", Type: imageType(item.Image)})
+		}
+		for _, author := range item.Authors {
+			entry.Authors = append(entry.Authors, atomPerson{Name: author})
+		}
+		for _, tag := range item.Tags {
+			entry.Categories = append(entry.Categories, atomCategory{Term: tag})
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	return marshalXML(feed)
+}
+
+// marshalXML renders XML document with the header
+func marshalXML(doc any) ([]byte, error) {
+	body, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+// JSON Feed 1.1, https://www.jsonfeed.org/version/1.1/
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url,omitempty"`
+	FeedURL     string         `json:"feed_url,omitempty"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url,omitempty"`
+	Title         string           `json:"title,omitempty"`
+	ContentText   string           `json:"content_text"`
+	Summary       string           `json:"summary,omitempty"`
+	Image         string           `json:"image,omitempty"`
+	DatePublished string           `json:"date_published,omitempty"`
+	DateModified  string           `json:"date_modified,omitempty"`
+	Authors       []jsonFeedAuthor `json:"authors,omitempty"`
+	Tags          []string         `json:"tags,omitempty"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+// renderJSONFeed renders news items as JSON Feed 1.1, article body is the content if extracted
+func renderJSONFeed(info feedInfo, items []NewsItem) ([]byte, error) {
+	feed := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       info.Title,
+		HomePageURL: info.Link,
+		FeedURL:     info.SelfURL,
+		Items:       []jsonFeedItem{},
+	}
+
+	for _, item := range items {
+		jsonItem := jsonFeedItem{
+			ID:            itemURL(item),
+			URL:           itemURL(item),
+			Title:         item.Title,
+			ContentText:   item.Description,
+			Summary:       item.Description,
+			Image:         item.Image,
+			DatePublished: item.Published.Format(time.RFC3339),
+			Tags:          item.Tags,
+		}
+		if item.Body != "" {
+			jsonItem.ContentText = item.Body
+		}
+		if item.ArticleModified != nil {
+			jsonItem.DateModified = item.ArticleModified.Format(time.RFC3339)
+		}
+		for _, author := range item.Authors {
+			jsonItem.Authors = append(jsonItem.Authors, jsonFeedAuthor{Name: author})
+		}
+		feed.Items = append(feed.Items, jsonItem)
+	}
+
+	return json.MarshalIndent(feed, "", "  ")
+}
+
+// requestBaseURL returns scheme and host the request was made to, proxy headers are respected
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host
+}
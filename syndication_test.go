@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// stubStorer returns fixed news and records filters of the last request
+type stubStorer struct {
+	news      []NewsItem
+	revisions []NewsRevision
+	filters   Filters
+	reenrich  ReenrichFilter
+}
+
+func (s *stubStorer) GetNews(_ context.Context, filters Filters) ([]NewsItem, Metadata, error) {
+	s.filters = filters
+	return s.news, Metadata{}, nil
+}
+
+func (s *stubStorer) GetSingleNews(_ context.Context, id int) (*NewsItem, error) {
+	for _, item := range s.news {
+		if item.ID == id {
+			return &item, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *stubStorer) GetRevisions(_ context.Context, _ int) ([]NewsRevision, error) {
+	return s.revisions, nil
+}
+
+func (s *stubStorer) RequeueNews(_ context.Context, f ReenrichFilter) (int, error) {
+	s.reenrich = f
+	if f.ID > len(s.news) {
+		return 0, nil
+	}
+	return len(s.news), nil
+}
+
+var syndicationNews = []NewsItem{
+	{
+		ID:           2,
+		Title:        "Second & latest",
+		Link:         "https://example.com/2?utm_source=rss",
+		CanonicalURL: "https://example.com/2",
+		Published:    time.Date(2024, 7, 2, 10, 0, 0, 0, time.UTC),
+		Description:  "Enriched description",
+		Image:        "https://example.com/2.png",
+		Body:         "First paragraph\n\nSecond paragraph",
+		Authors:      []string{"Jane Doe"},
+		Tags:         []string{"World"},
+	},
+	{
+		ID:          1,
+		Title:       "First",
+		Link:        "https://example.com/1",
+		Published:   time.Date(2024, 7, 1, 10, 0, 0, 0, time.UTC),
+		Description: "Feed description",
+	},
+}
+
+func Test_RenderRSS(t *testing.T) {
+	body, err := renderRSS(feedInfo{Title: "Latest News", Link: "http://localhost/", SelfURL: "http://localhost/feed.rss"}, syndicationNews)
+	assert.NoError(t, err)
+
+	doc := struct {
+		Channel struct {
+			Items []struct {
+				Title     string `xml:"title"`
+				Link      string `xml:"link"`
+				Creator   string `xml:"http://purl.org/dc/elements/1.1/ creator"`
+				Enclosure struct {
+					URL  string `xml:"url,attr"`
+					Type string `xml:"type,attr"`
+				} `xml:"enclosure"`
+				Media struct {
+					URL string `xml:"url,attr"`
+				} `xml:"http://search.yahoo.com/mrss/ content"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}{}
+	assert.NoError(t, xml.Unmarshal(body, &doc))
+	assert.Len(t, doc.Channel.Items, 2)
+
+	item := doc.Channel.Items[0]
+	assert.Equal(t, "Second & latest", item.Title)
+	assert.Equal(t, "https://example.com/2", item.Link)
+	assert.Equal(t, "Jane Doe", item.Creator)
+	assert.Equal(t, "https://example.com/2.png", item.Enclosure.URL)
+	assert.Equal(t, "image/png", item.Enclosure.Type)
+	assert.Equal(t, "https://example.com/2.png", item.Media.URL)
+
+	assert.Empty(t, doc.Channel.Items[1].Enclosure.URL)
+}
+
+func Test_RenderAtom(t *testing.T) {
+	body, err := renderAtom(feedInfo{Title: "Latest News", Updated: syndicationNews[0].Published}, syndicationNews)
+	assert.NoError(t, err)
+
+	feed := struct {
+		Updated string `xml:"updated"`
+		Entries []struct {
+			ID    string `xml:"id"`
+			Links []struct {
+				Href string `xml:"href,attr"`
+				Rel  string `xml:"rel,attr"`
+			} `xml:"link"`
+		} `xml:"entry"`
+	}{}
+	assert.NoError(t, xml.Unmarshal(body, &feed))
+	assert.Equal(t, "2024-07-02T10:00:00Z", feed.Updated)
+	assert.Len(t, feed.Entries, 2)
+	assert.Equal(t, "https://example.com/2", feed.Entries[0].ID)
+	assert.Len(t, feed.Entries[0].Links, 2)
+	assert.Equal(t, "enclosure", feed.Entries[0].Links[1].Rel)
+	assert.Equal(t, "https://example.com/2.png", feed.Entries[0].Links[1].Href)
+}
+
+func Test_RenderJSONFeed(t *testing.T) {
+	body, err := renderJSONFeed(feedInfo{Title: "Latest News"}, syndicationNews)
+	assert.NoError(t, err)
+
+	feed := jsonFeed{}
+	assert.NoError(t, json.Unmarshal(body, &feed))
+	assert.Equal(t, "https://jsonfeed.org/version/1.1", feed.Version)
+	assert.Len(t, feed.Items, 2)
+	assert.Equal(t, "First paragraph\n\nSecond paragraph", feed.Items[0].ContentText)
+	assert.Equal(t, "Enriched description", feed.Items[0].Summary)
+	assert.Equal(t, "https://example.com/2.png", feed.Items[0].Image)
+	assert.Equal(t, "Feed description", feed.Items[1].ContentText)
+}
+
+func Test_SyndicationHandler(t *testing.T) {
+	ctx := context.Background()
+	storage := &stubStorer{news: syndicationNews}
+	api, err := NewAPIServer(storage, APIConfig{})
+	assert.NoError(t, err)
+
+	ts := httptest.NewServer(api.router(ctx))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/feed.atom?feed=3&q=storm&from=2024-07-01")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, atomContentType, resp.Header.Get("Content-Type"))
+	assert.Equal(t, "Tue, 02 Jul 2024 10:00:00 GMT", resp.Header.Get("Last-Modified"))
+
+	// filters are passed to the storage, feed page size is the default
+	assert.Equal(t, 3, storage.filters.FeedID)
+	assert.Equal(t, "storm", storage.filters.Query)
+	assert.Equal(t, time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC), storage.filters.From)
+	assert.Equal(t, feedDefaultFilters.PageSize, storage.filters.PageSize)
+
+	etag := resp.Header.Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	// unchanged feed is not sent again
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/feed.atom?feed=3&q=storm&from=2024-07-01", http.NoBody)
+	assert.NoError(t, err)
+	req.Header.Set("If-None-Match", etag)
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+	req, err = http.NewRequest(http.MethodGet, ts.URL+"/feed.rss", http.NoBody)
+	assert.NoError(t, err)
+	req.Header.Set("If-Modified-Since", "Tue, 02 Jul 2024 10:00:00 GMT")
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+}